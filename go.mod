@@ -1,16 +1,42 @@
 module github.com/lthibault/pipewerks
 
-go 1.12
+go 1.22
 
 require (
 	github.com/SentimensRG/ctx v0.0.0-20180729130232-0bfd988c655d
-	github.com/hashicorp/yamux v0.0.0-20181012175058-2f1d1f20f75d
+	github.com/flynn/noise v1.0.0
+	github.com/gorilla/websocket v1.4.2
+	github.com/hashicorp/yamux v0.1.2
 	github.com/jpillora/backoff v0.0.0-20180909062703-3050d21c67d7
 	github.com/lthibault/log v0.0.0-20190513014217-f549b3a28a20
 	github.com/lthibault/toolz v0.0.0-20190613123839-0a7d14f0fcab
-	github.com/lucas-clemente/quic-go v0.11.2
 	github.com/pkg/errors v0.8.1
+	github.com/quic-go/quic-go v0.48.2
+	github.com/stretchr/testify v1.9.0
+	github.com/xtaci/kcp-go/v5 v5.5.8
+	github.com/xtaci/smux v1.5.56
+	golang.org/x/crypto v0.26.0
+	golang.org/x/net v0.28.0
+	golang.org/x/sync v0.8.0
+	golang.org/x/sys v0.23.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-task/slim-sprig v0.0.0-20230315185526-52ccab3ef572 // indirect
+	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38 // indirect
+	github.com/klauspost/cpuid v1.3.1 // indirect
+	github.com/klauspost/reedsolomon v1.9.3 // indirect
+	github.com/onsi/ginkgo/v2 v2.9.5 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/sirupsen/logrus v1.4.2 // indirect
-	github.com/stretchr/testify v1.3.0
-	golang.org/x/sync v0.0.0-20190423024810-112230192c58
+	github.com/templexxx/cpu v0.0.1 // indirect
+	github.com/templexxx/xorsimd v0.4.1 // indirect
+	github.com/tjfoc/gmsm v1.0.1 // indirect
+	go.uber.org/mock v0.4.0 // indirect
+	golang.org/x/exp v0.0.0-20240506185415-9bf2ced13842 // indirect
+	golang.org/x/mod v0.17.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
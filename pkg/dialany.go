@@ -0,0 +1,118 @@
+package pipe
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDialDelay between successive connection attempts, as recommended by
+// RFC 8305.
+const DefaultDialDelay = 250 * time.Millisecond
+
+// Endpoint is an address, along with the transport by which it is reached
+type Endpoint struct {
+	Transport Transport
+	Addr      net.Addr
+}
+
+// Dialer races connection attempts to several endpoints, in the manner of Happy
+// Eyeballs (RFC 8305).  Endpoints are attempted in order of preference, each
+// attempt starting after a delay, or as soon as the previous one fails.  The
+// first connection to be established is returned, and the remaining attempts
+// are canceled.
+//
+// Endpoints are not reordered, so callers should list them by preference, e.g.
+// QUIC before TCP, and interleave address families if appropriate.
+type Dialer struct {
+	// Delay between successive attempts.  Defaults to DefaultDialDelay.
+	Delay time.Duration
+}
+
+type dialResult struct {
+	conn Conn
+	err  error
+}
+
+// DialAny endpoint.  If every attempt fails, the first error is returned.
+func (d Dialer) DialAny(c context.Context, eps []Endpoint) (Conn, error) {
+	if len(eps) == 0 {
+		return nil, errors.New("dial any: no endpoints")
+	}
+
+	delay := d.Delay
+	if delay == 0 {
+		delay = DefaultDialDelay
+	}
+
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	now := make(chan time.Time)
+	close(now)
+
+	var (
+		results                  = make(chan dialResult)
+		next    <-chan time.Time = now
+		started int
+		pending int
+		first   error
+	)
+
+	for {
+		if started == len(eps) {
+			next = nil
+		}
+
+		select {
+		case <-next:
+			go attempt(ctx, eps[started], results)
+			started++
+			pending++
+			next = time.After(delay)
+
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.conn, nil
+			}
+
+			if first == nil {
+				first = r.err
+			}
+
+			if started == len(eps) && pending == 0 {
+				return nil, errors.Wrap(first, "dial any")
+			}
+
+			next = now // don't wait to start the next attempt
+
+		case <-c.Done():
+			return nil, c.Err()
+		}
+	}
+}
+
+// attempt to dial an endpoint.  Connections that are established after the race
+// was decided are closed.
+func attempt(c context.Context, ep Endpoint, results chan<- dialResult) {
+	conn, err := ep.Transport.Dial(c, ep.Addr)
+	if err != nil {
+		err = errors.Wrapf(err, "%s %s", ep.Addr.Network(), ep.Addr)
+	}
+
+	select {
+	case results <- dialResult{conn: conn, err: err}:
+	case <-c.Done():
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+// DialAny endpoint using the default Dialer
+func DialAny(c context.Context, eps []Endpoint) (Conn, error) {
+	return Dialer{}.DialAny(c, eps)
+}
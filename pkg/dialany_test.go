@@ -0,0 +1,171 @@
+package pipe
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockConn struct {
+	Conn
+	a      net.Addr
+	closed int32
+}
+
+func (c *mockConn) RemoteAddr() net.Addr { return c.a }
+
+func (c *mockConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *mockConn) isClosed() bool { return atomic.LoadInt32(&c.closed) == 1 }
+
+// raceTransport establishes a connection after a delay, or fails.  Stubborn
+// transports ignore cancellation.
+type raceTransport struct {
+	delay    time.Duration
+	err      error
+	stubborn bool
+	dialed   int32
+
+	mu   sync.Mutex
+	conn *mockConn
+}
+
+func (t *raceTransport) established() *mockConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn
+}
+
+func (t *raceTransport) Listen(context.Context, net.Addr) (Listener, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (t *raceTransport) Dial(c context.Context, a net.Addr) (Conn, error) {
+	atomic.AddInt32(&t.dialed, 1)
+
+	cancel := c.Done()
+	if t.stubborn {
+		cancel = nil
+	}
+
+	select {
+	case <-time.After(t.delay):
+	case <-cancel:
+		return nil, c.Err()
+	}
+
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.conn = &mockConn{a: a}
+	return t.conn, nil
+}
+
+func endpoints(ts ...*raceTransport) []Endpoint {
+	eps := make([]Endpoint, len(ts))
+	for i, t := range ts {
+		eps[i] = Endpoint{Transport: t, Addr: mockAddr(string(rune('a' + i)))}
+	}
+	return eps
+}
+
+func TestDialAny(t *testing.T) {
+	d := Dialer{Delay: 50 * time.Millisecond}
+
+	t.Run("Preferred", func(t *testing.T) {
+		a, b := &raceTransport{}, &raceTransport{}
+
+		conn, err := d.DialAny(context.Background(), endpoints(a, b))
+		if assert.NoError(t, err) {
+			assert.Equal(t, mockAddr("a"), conn.RemoteAddr())
+		}
+
+		time.Sleep(2 * d.Delay)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&b.dialed), "fallback attempted")
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		a, b := &raceTransport{delay: time.Minute}, &raceTransport{}
+
+		conn, err := d.DialAny(context.Background(), endpoints(a, b))
+		if assert.NoError(t, err) {
+			assert.Equal(t, mockAddr("b"), conn.RemoteAddr())
+		}
+	})
+
+	t.Run("FailFast", func(t *testing.T) {
+		a, b := &raceTransport{err: errors.New("refused")}, &raceTransport{}
+
+		start := time.Now()
+		conn, err := Dialer{Delay: time.Minute}.DialAny(context.Background(), endpoints(a, b))
+		if assert.NoError(t, err) {
+			assert.Equal(t, mockAddr("b"), conn.RemoteAddr())
+		}
+		assert.True(t, time.Since(start) < time.Second, "fallback waited for delay")
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		// b starts after a, but completes first
+		a := &raceTransport{delay: 2 * d.Delay}
+		b := &raceTransport{}
+
+		conn, err := d.DialAny(context.Background(), endpoints(a, b))
+		if assert.NoError(t, err) {
+			assert.Equal(t, mockAddr("b"), conn.RemoteAddr())
+		}
+
+		time.Sleep(3 * d.Delay)
+		assert.Nil(t, a.established(), "attempt not canceled")
+		assert.False(t, b.established().isClosed())
+	})
+
+	t.Run("CloseLoser", func(t *testing.T) {
+		a := &raceTransport{delay: 2 * d.Delay, stubborn: true}
+		b := &raceTransport{}
+
+		_, err := d.DialAny(context.Background(), endpoints(a, b))
+		assert.NoError(t, err)
+
+		time.Sleep(3 * d.Delay)
+		if assert.NotNil(t, a.established()) {
+			assert.True(t, a.established().isClosed(), "losing connection left open")
+		}
+	})
+
+	t.Run("AllFail", func(t *testing.T) {
+		a := &raceTransport{err: errors.New("refused")}
+		b := &raceTransport{delay: 10 * time.Millisecond, err: errors.New("unreachable")}
+
+		_, err := d.DialAny(context.Background(), endpoints(a, b))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "refused")
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&b.dialed))
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := d.DialAny(c, endpoints(&raceTransport{delay: time.Minute}))
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("NoEndpoints", func(t *testing.T) {
+		_, err := d.DialAny(context.Background(), nil)
+		assert.Error(t, err)
+	})
+}
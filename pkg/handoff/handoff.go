@@ -0,0 +1,318 @@
+// Package handoff passes listening sockets from a running process to its
+// replacement, so that a daemon can be upgraded without refusing connections.
+//
+// The parent process creates its listeners through an Upgrader, and starts the
+// new binary with Upgrade.  The sockets are sent to the child over a unix
+// socket, and the child adopts them as it creates its own listeners, before
+// signalling that it is Ready.  The parent then stops accepting connections, and
+// Drains those it had accepted.
+//
+// Any transport built on generic.Transport can be handed off by setting the
+// Upgrader as its NetListener, e.g. with tcp.OptListener or unix.OptListener.
+// QUIC listeners are handed off with quic.OptPacketListener.  Note that QUIC
+// connections cannot be drained, as the parent no longer reads from the shared UDP
+// socket once the child is ready.
+package handoff
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+// EnvFD holds the descriptor of the handoff socket in the child process
+const EnvFD = "PIPEWERKS_HANDOFF_FD"
+
+const (
+	kindStream = "stream"
+	kindPacket = "packet"
+)
+
+// entry of the manifest sent alongside the sockets, in the same order
+type entry struct {
+	Kind    string `json:"kind"`
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
+
+func (e entry) key() string { return e.Kind + " " + e.Network + " " + e.Address }
+
+// filer is implemented by the standard library's listeners and packet conns
+type filer interface {
+	File() (*os.File, error)
+}
+
+// socket that may be handed off
+type socket struct {
+	entry
+	s interface {
+		filer
+		Close() error
+	}
+}
+
+// Upgrader hands off listeners to a child process.  It satisfies both
+// generic.NetListener and generic.PacketListener.
+type Upgrader struct {
+	mu        sync.Mutex
+	inherited map[string][]*os.File
+	sockets   []socket
+	listeners map[*trackedListener]struct{}
+	conns     map[*tracked]struct{}
+	drained   chan struct{}
+	stopped   bool
+
+	parent *net.UnixConn // nil unless the process was started by Upgrade
+}
+
+// New Upgrader.  If the process was started by Upgrade, the sockets passed by
+// the parent are received, and will be adopted by matching listeners.
+func New() (*Upgrader, error) {
+	u := &Upgrader{
+		inherited: make(map[string][]*os.File),
+		listeners: make(map[*trackedListener]struct{}),
+		conns:     make(map[*tracked]struct{}),
+		drained:   make(chan struct{}),
+	}
+
+	if err := u.receive(); err != nil {
+		return nil, errors.Wrap(err, "handoff")
+	}
+
+	return u, nil
+}
+
+// Inherited reports whether the process was started by Upgrade
+func (u *Upgrader) Inherited() bool { return u.parent != nil }
+
+// Listen on an inherited socket, or on a new one.  Sockets are matched by the
+// network and address with which the parent created them, rather than the
+// address they are bound to, so that a child with the same configuration adopts
+// the same sockets even if they were bound to an ephemeral port.
+func (u *Upgrader) Listen(c context.Context, network, address string) (net.Listener, error) {
+	e := entry{Kind: kindStream, Network: network, Address: address}
+
+	var (
+		l   net.Listener
+		err error
+	)
+
+	if f := u.adopt(e); f != nil {
+		l, err = net.FileListener(f)
+		f.Close()
+	} else {
+		l, err = new(net.ListenConfig).Listen(c, network, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := l.(interface {
+		filer
+		Close() error
+	})
+	if !ok {
+		l.Close()
+		return nil, errors.Errorf("handoff: %s listeners cannot be handed off", network)
+	}
+
+	u.register(socket{entry: e, s: s})
+	return l, nil
+}
+
+// ListenPacket on an inherited socket, or on a new one.  Sockets are matched as
+// in Listen.
+func (u *Upgrader) ListenPacket(c context.Context, network, address string) (net.PacketConn, error) {
+	e := entry{Kind: kindPacket, Network: network, Address: address}
+
+	var (
+		pc  net.PacketConn
+		err error
+	)
+
+	if f := u.adopt(e); f != nil {
+		pc, err = net.FilePacketConn(f)
+		f.Close()
+	} else {
+		pc, err = new(net.ListenConfig).ListenPacket(c, network, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := pc.(interface {
+		filer
+		Close() error
+	})
+	if !ok {
+		pc.Close()
+		return nil, errors.Errorf("handoff: %s sockets cannot be handed off", network)
+	}
+
+	u.register(socket{entry: e, s: s})
+	return pc, nil
+}
+
+func (u *Upgrader) adopt(e entry) *os.File {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	fs := u.inherited[e.key()]
+	if len(fs) == 0 {
+		return nil
+	}
+
+	u.inherited[e.key()] = fs[1:]
+	return fs[0]
+}
+
+func (u *Upgrader) register(s socket) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.sockets = append(u.sockets, s)
+}
+
+// Track the connections accepted by a listener, so that they can be drained.
+// The listener is closed when the child process is ready.
+func (u *Upgrader) Track(l pipe.Listener) pipe.Listener {
+	tl := &trackedListener{Listener: l, u: u}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.stopped {
+		l.Close()
+	} else {
+		u.listeners[tl] = struct{}{}
+	}
+
+	return tl
+}
+
+// trackedListener and tracked are used as map keys, as listeners and
+// connections may not be comparable.
+type trackedListener struct {
+	pipe.Listener
+	u *Upgrader
+}
+
+type tracked struct{ pipe.Conn }
+
+func (l *trackedListener) Accept() (pipe.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tracked{conn}
+
+	l.u.mu.Lock()
+	l.u.conns[t] = struct{}{}
+	l.u.mu.Unlock()
+
+	go func() {
+		<-conn.Context().Done()
+		l.u.release(t)
+	}()
+
+	return conn, nil
+}
+
+func (l *trackedListener) Close() error {
+	l.u.mu.Lock()
+	delete(l.u.listeners, l)
+	l.u.mu.Unlock()
+
+	return l.Listener.Close()
+}
+
+func (u *Upgrader) release(t *tracked) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	delete(u.conns, t)
+	u.signal()
+}
+
+// signal waiters in Drain.  The caller must hold the lock.
+func (u *Upgrader) signal() {
+	close(u.drained)
+	u.drained = make(chan struct{})
+}
+
+// stop accepting connections, once the child is ready
+func (u *Upgrader) stop() {
+	u.mu.Lock()
+	u.stopped = true
+
+	ls := make([]pipe.Listener, 0, len(u.listeners))
+	for l := range u.listeners {
+		ls = append(ls, l.Listener)
+	}
+	u.listeners = make(map[*trackedListener]struct{})
+
+	ss := u.sockets
+	u.sockets = nil
+	u.mu.Unlock()
+
+	// the child is listening on the socket files
+	for _, s := range ss {
+		if ul, ok := s.s.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	for _, l := range ls {
+		l.Close()
+	}
+
+	// closing a listener twice is harmless
+	for _, s := range ss {
+		s.s.Close()
+	}
+}
+
+// Drain waits for the connections accepted by tracked listeners to close.  When
+// the context expires, the remaining connections are closed, and its error is
+// returned.
+func (u *Upgrader) Drain(c context.Context) error {
+	for {
+		u.mu.Lock()
+		n, ch := len(u.conns), u.drained
+		u.mu.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-ch:
+		case <-c.Done():
+			u.mu.Lock()
+			cs := make([]pipe.Conn, 0, len(u.conns))
+			for t := range u.conns {
+				cs = append(cs, t.Conn)
+			}
+			u.mu.Unlock()
+
+			for _, conn := range cs {
+				conn.Close()
+			}
+
+			return c.Err()
+		}
+	}
+}
+
+var (
+	_ generic.NetListener    = (*Upgrader)(nil)
+	_ generic.PacketListener = (*Upgrader)(nil)
+)
@@ -0,0 +1,302 @@
+//go:build linux
+// +build linux
+
+package handoff
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/lthibault/pipewerks/pkg/transport/tcp"
+	"github.com/lthibault/pipewerks/pkg/transport/unix"
+	"github.com/stretchr/testify/assert"
+)
+
+const helperEnv = "PIPEWERKS_HANDOFF_HELPER"
+
+// serve writes msg on each stream, until the listener is closed
+func serve(l pipe.Listener, msg string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for {
+				s, err := conn.AcceptStream()
+				if err != nil {
+					return
+				}
+
+				s.Write([]byte(msg))
+				s.Close()
+			}
+		}()
+	}
+}
+
+// greeting reads the message written on a new stream
+func greeting(t *testing.T, conn pipe.Conn) string {
+	s, err := conn.OpenStream()
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer s.Close()
+
+	b, err := ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func greet(t *testing.T, tp pipe.Transport, a net.Addr) string {
+	conn, err := tp.Dial(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer conn.Close()
+
+	return greeting(t, conn)
+}
+
+// TestUpgradeHelper is started by TestUpgrade, and listens with the same
+// configuration as its parent.
+func TestUpgradeHelper(t *testing.T) {
+	env := os.Getenv(helperEnv)
+	if env == "" {
+		return
+	}
+	args := strings.Split(env, "|")
+	tcpAddr, unixAddr := args[1], args[2]
+
+	u, err := New()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, u.Inherited())
+
+	c := context.Background()
+
+	tl, err := tcp.New(tcp.OptListener(u)).Listen(c, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, tcpAddr, tl.Addr().String())
+
+	ul, err := unix.New(unix.OptListener(u)).Listen(c, &net.UnixAddr{Net: "unix", Name: args[0]})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, unixAddr, ul.Addr().String())
+
+	go serve(tl, "child")
+	go serve(ul, "child")
+
+	assert.NoError(t, u.Ready())
+
+	// the parent closes stdin once it is done
+	ioutil.ReadAll(os.Stdin)
+}
+
+func TestUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipewerks-handoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, err := New()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, u.Inherited())
+
+	c := context.Background()
+	path := filepath.Join(dir, "sock")
+
+	tt := tcp.New(tcp.OptListener(u))
+	tl, err := tt.Listen(c, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	tl = u.Track(tl)
+	defer tl.Close()
+
+	ut := unix.New(unix.OptListener(u))
+	ul, err := ut.Listen(c, &net.UnixAddr{Net: "unix", Name: path})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ul = u.Track(ul)
+	defer ul.Close()
+
+	go serve(tl, "parent")
+	go serve(ul, "parent")
+
+	old, err := tt.Dial(c, tl.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer old.Close()
+	assert.Equal(t, "parent", greeting(t, old))
+
+	stdin, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestUpgradeHelper$")
+	cmd.Env = append(os.Environ(), helperEnv+"="+path+"|"+tl.Addr().String()+"|"+ul.Addr().String())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, os.Stdout, os.Stderr
+
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	err = u.Upgrade(ctx, cmd)
+	stdin.Close()
+	if !assert.NoError(t, err) {
+		cmd.Process.Kill()
+		return
+	}
+
+	// new connections are accepted by the child
+	assert.Equal(t, "child", greet(t, tt, tl.Addr()))
+	assert.Equal(t, "child", greet(t, ut, ul.Addr()))
+
+	_, err = tl.Accept()
+	assert.Error(t, err, "parent listener still open")
+
+	// existing connections are still served by the parent
+	assert.Equal(t, "parent", greeting(t, old))
+
+	dc, cancel := context.WithTimeout(c, 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, u.Drain(dc))
+
+	select {
+	case <-old.Context().Done():
+	case <-time.After(time.Second):
+		t.Error("connection not closed when drain expired")
+	}
+
+	assert.NoError(t, u.Drain(c))
+
+	w.Close()
+	assert.NoError(t, cmd.Wait())
+}
+
+func TestUpgradeFailed(t *testing.T) {
+	u, err := New()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tt := tcp.New(tcp.OptListener(u))
+	l, err := tt.Listen(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	l = u.Track(l)
+	defer l.Close()
+	go serve(l, "parent")
+
+	// the child exits without signalling readiness
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	assert.Error(t, u.Upgrade(context.Background(), cmd))
+	cmd.Wait()
+
+	assert.Equal(t, "parent", greet(t, tt, l.Addr()))
+}
+
+func TestDrain(t *testing.T) {
+	u, err := New()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tt := tcp.New(tcp.OptListener(u))
+	l, err := tt.Listen(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	l = u.Track(l)
+	defer l.Close()
+	go serve(l, "parent")
+
+	conn, err := tt.Dial(context.Background(), l.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "parent", greeting(t, conn))
+
+	drained := make(chan error, 1)
+	go func() { drained <- u.Drain(context.Background()) }()
+
+	select {
+	case <-drained:
+		t.Fatal("drained with an open connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.Close()
+
+	select {
+	case err = <-drained:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("not drained after the connection was closed")
+	}
+}
+
+// mkTLS returns client and server configurations, with a self-signed certificate
+// for 127.0.0.1.
+func mkTLS(t *testing.T) (client, server *tls.Config) {
+	cert, pool := transporttest.Cert(t)
+	return &tls.Config{RootCAs: pool}, &tls.Config{Certificates: []tls.Certificate{cert}}
+}
+
+// TestTrackUncomparable tracks a listener and connections whose dynamic types
+// cannot be used as map keys.
+func TestTrackUncomparable(t *testing.T) {
+	u, err := New()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	client, server := mkTLS(t)
+	negotiate := tcp.OptGeneric(generic.OptNegotiate(
+		generic.MuxProtocol{ID: generic.YamuxID, MuxAdapter: generic.MuxConfig{}},
+		generic.MuxProtocol{ID: generic.SmuxID, MuxAdapter: generic.SmuxConfig{}}))
+
+	l, err := tcp.New(tcp.OptListener(u), tcp.OptTLS(server), negotiate).
+		Listen(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	l = u.Track(l)
+	defer l.Close()
+	go serve(l, "parent")
+
+	conn, err := tcp.New(tcp.OptTLS(client), negotiate).Dial(context.Background(), l.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "parent", greeting(t, conn))
+
+	c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, u.Drain(c))
+	assert.NoError(t, u.Drain(context.Background()))
+}
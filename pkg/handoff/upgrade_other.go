@@ -0,0 +1,21 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package handoff
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Upgrade is not supported on this platform
+func (u *Upgrader) Upgrade(c context.Context, cmd *exec.Cmd) error {
+	return errors.New("handoff: not supported on this platform")
+}
+
+// Ready has no effect on this platform
+func (u *Upgrader) Ready() error { return nil }
+
+func (u *Upgrader) receive() error { return nil }
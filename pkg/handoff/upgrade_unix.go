@@ -0,0 +1,258 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package handoff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// maxFiles that can be passed in a single message
+const maxFiles = 253
+
+// maxManifest is the size of the largest manifest that can be received
+const maxManifest = 1 << 16
+
+// Upgrade starts cmd, and hands off every socket created by the Upgrader.  It
+// returns once the child is Ready, after which the listeners are closed.  The
+// child's handoff socket is appended to cmd.ExtraFiles, and its descriptor is
+// set in the environment.  If the child exits or the context expires first, the
+// listeners are left open.
+func (u *Upgrader) Upgrade(c context.Context, cmd *exec.Cmd) error {
+	u.mu.Lock()
+	manifest := make([]entry, 0, len(u.sockets))
+	files := make([]*os.File, 0, len(u.sockets))
+	for _, s := range u.sockets {
+		f, err := s.s.File()
+		if err != nil {
+			u.mu.Unlock()
+			closeFiles(files)
+			return errors.Wrapf(err, "handoff: %s %s", s.Network, s.Address)
+		}
+
+		manifest = append(manifest, s.entry)
+		files = append(files, f)
+	}
+	u.mu.Unlock()
+	defer closeFiles(files)
+
+	if len(files) > maxFiles {
+		return errors.Errorf("handoff: cannot pass more than %d sockets", maxFiles)
+	}
+
+	msg, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.Wrap(err, "handoff: marshal manifest")
+	}
+
+	conn, remote, err := socketpair()
+	if err != nil {
+		return errors.Wrap(err, "handoff: socketpair")
+	}
+	defer conn.Close()
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, remote)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", EnvFD, 2+len(cmd.ExtraFiles)))
+
+	err = cmd.Start()
+	remote.Close()
+	if err != nil {
+		return errors.Wrap(err, "handoff: start")
+	}
+
+	fds, err := rawFds(files)
+	if err != nil {
+		return errors.Wrap(err, "handoff")
+	}
+
+	if _, _, err = conn.WriteMsgUnix(msg, syscall.UnixRights(fds...), nil); err != nil {
+		return errors.Wrap(err, "handoff: send")
+	}
+
+	// unblock the read below if the context expires
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var b [1]byte
+	if _, err = conn.Read(b[:]); err != nil {
+		if c.Err() != nil {
+			return c.Err()
+		}
+
+		return errors.New("handoff: child exited before it was ready")
+	}
+
+	u.stop()
+	return nil
+}
+
+// Ready signals the parent that the child has created its listeners.  Sockets
+// that were not adopted are closed.  It has no effect if the process was not
+// started by Upgrade.
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for key, fs := range u.inherited {
+		closeFiles(fs)
+		delete(u.inherited, key)
+	}
+
+	if u.parent == nil {
+		return nil
+	}
+
+	defer func() {
+		u.parent.Close()
+		u.parent = nil
+	}()
+
+	_, err := u.parent.Write([]byte{1})
+	return errors.Wrap(err, "handoff: signal parent")
+}
+
+// receive the sockets passed by the parent, if any
+func (u *Upgrader) receive() error {
+	s := os.Getenv(EnvFD)
+	if s == "" {
+		return nil
+	}
+	os.Unsetenv(EnvFD) // not for our own children
+
+	fd, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s", EnvFD)
+	}
+
+	syscall.CloseOnExec(fd)
+	f := os.NewFile(uintptr(fd), "handoff")
+	fc, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	conn, ok := fc.(*net.UnixConn)
+	if !ok {
+		fc.Close()
+		return errors.Errorf("%s is not a unix socket", EnvFD)
+	}
+
+	msg := make([]byte, maxManifest)
+	oob := make([]byte, syscall.CmsgSpace(maxFiles*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(msg, oob)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "receive")
+	}
+
+	files, err := parseRights(oob[:oobn])
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	var manifest []entry
+	if err = json.Unmarshal(msg[:n], &manifest); err != nil || len(manifest) != len(files) {
+		conn.Close()
+		closeFiles(files)
+		return errors.New("malformed manifest")
+	}
+
+	for i, e := range manifest {
+		u.inherited[e.key()] = append(u.inherited[e.key()], files[i])
+	}
+
+	u.parent = conn
+	return nil
+}
+
+func parseRights(oob []byte) ([]*os.File, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse control message")
+	}
+
+	var files []*os.File
+	for _, m := range msgs {
+		fds, err := syscall.ParseUnixRights(&m)
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			syscall.CloseOnExec(fd)
+			files = append(files, os.NewFile(uintptr(fd), "handoff"))
+		}
+	}
+
+	return files, nil
+}
+
+// socketpair returns the parent's end as a connection, and the child's as a
+// file.  SOCK_SEQPACKET preserves the boundary of the manifest.
+func socketpair() (*net.UnixConn, *os.File, error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	local := os.NewFile(uintptr(fds[0]), "handoff")
+	fc, err := net.FileConn(local)
+	local.Close()
+	if err != nil {
+		syscall.Close(fds[1])
+		return nil, nil, err
+	}
+
+	return fc.(*net.UnixConn), os.NewFile(uintptr(fds[1]), "handoff"), nil
+}
+
+// rawFds of files that remain open.  File.Fd is avoided, as it would put the
+// sockets, which are shared with the listeners, in blocking mode.
+func rawFds(fs []*os.File) ([]int, error) {
+	fds := make([]int, len(fs))
+	for i, f := range fs {
+		rc, err := f.SyscallConn()
+		if err != nil {
+			return nil, err
+		}
+
+		if err = rc.Control(func(fd uintptr) { fds[i] = int(fd) }); err != nil {
+			return nil, err
+		}
+	}
+
+	return fds, nil
+}
+
+func closeFiles(fs []*os.File) {
+	for _, f := range fs {
+		f.Close()
+	}
+}
@@ -0,0 +1,111 @@
+package transporttest
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+// HalfClose checks that streams can be closed in one direction while remaining
+// usable in the other.  The dialer opens the streams.
+func HalfClose(t *testing.T, dc, lc pipe.Conn) {
+	// openPair sends a byte on the new stream, as some transports only announce
+	// a stream once data is sent on it.
+	openPair := func() (ds, ls pipe.Stream) {
+		var g errgroup.Group
+		g.Go(func() (err error) {
+			if ds, err = dc.OpenStream(); err == nil {
+				_, err = ds.Write([]byte{0})
+			}
+			return
+		})
+		g.Go(func() (err error) {
+			if ls, err = lc.AcceptStream(); err == nil {
+				_, err = io.ReadFull(ls, make([]byte, 1))
+			}
+			return
+		})
+		assert.NoError(t, g.Wait())
+		return
+	}
+
+	t.Run("CloseWrite", func(t *testing.T) {
+		ds, ls := openPair()
+
+		var g errgroup.Group
+		g.Go(func() error {
+			if _, err := ds.Write([]byte("ping")); err != nil {
+				return err
+			}
+			return ds.CloseWrite()
+		})
+
+		b, err := ioutil.ReadAll(ls)
+		assert.NoError(t, err)
+		assert.Equal(t, "ping", string(b))
+		assert.NoError(t, g.Wait())
+
+		_, err = ds.Write([]byte("ping"))
+		assert.Error(t, err, "write succeeded on closed write-side")
+
+		g.Go(func() error {
+			if _, err := ls.Write([]byte("pong")); err != nil {
+				return err
+			}
+			return ls.CloseWrite()
+		})
+
+		b, err = ioutil.ReadAll(ds)
+		assert.NoError(t, err, "read-side closed by CloseWrite")
+		assert.Equal(t, "pong", string(b))
+		assert.NoError(t, g.Wait())
+	})
+
+	t.Run("CloseRead", func(t *testing.T) {
+		ds, ls := openPair()
+
+		assert.NoError(t, ds.CloseRead())
+		_, err := ds.Read(make([]byte, 1))
+		assert.Error(t, err)
+
+		var g errgroup.Group
+		g.Go(func() error {
+			if _, err := ds.Write([]byte("ping")); err != nil {
+				return err
+			}
+			return ds.CloseWrite()
+		})
+
+		b, err := ioutil.ReadAll(ls)
+		assert.NoError(t, err, "write-side closed by CloseRead")
+		assert.Equal(t, "ping", string(b))
+		assert.NoError(t, g.Wait())
+	})
+
+	t.Run("WriteAfterCloseRead", func(t *testing.T) {
+		ds, ls := openPair()
+		defer ds.Close()
+		defer ls.Close()
+
+		assert.NoError(t, ds.CloseRead())
+
+		// more than fits in the receive window.  The write may fail, but must
+		// not block.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ls.Write(make([]byte, 1<<22))
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+			t.Error("remote writer blocked by CloseRead")
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// Package transporttest provides the tests shared by the transports.
+package transporttest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	dialerSends   = "dialer"
+	listenerSends = "listener"
+)
+
+// Run listens on a, and checks that data can be exchanged with a connection
+// dialed to the listener's address.
+func Run(t *testing.T, tp pipe.Transport, a net.Addr) {
+	l, err := tp.Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { assert.NoError(t, l.Close()) }()
+
+	RunListener(t, tp, l, l.Addr())
+}
+
+// RunListener checks that data can be exchanged between a connection accepted by
+// l, and one dialed to a.  The listener opens a stream, and both ends send a
+// message on it.
+func RunListener(t *testing.T, tp pipe.Transport, l pipe.Listener, a net.Addr) {
+	c, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var dc, lc pipe.Conn
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		lc, err = l.Accept()
+		return errors.Wrap(err, "accept")
+	})
+	g.Go(func() (err error) {
+		dc, err = tp.Dial(c, a)
+		return errors.Wrap(err, "dial")
+	})
+	if !assert.NoError(t, g.Wait()) {
+		return
+	}
+	defer func() { assert.NoError(t, lc.Close()) }()
+	defer func() { assert.NoError(t, dc.Close()) }()
+
+	// Streams are opened and used concurrently with AcceptStream, as some
+	// transports only announce a stream once data is sent on it.
+	var ds, ls pipe.Stream
+	g.Go(func() (err error) {
+		if ls, err = lc.OpenStream(); err != nil {
+			return errors.Wrap(err, "open stream")
+		}
+		return exchange("listener", ls, listenerSends, dialerSends)
+	})
+	g.Go(func() (err error) {
+		if ds, err = dc.AcceptStream(); err != nil {
+			return errors.Wrap(err, "accept stream")
+		}
+		return exchange("dialer", ds, dialerSends, listenerSends)
+	})
+	assert.NoError(t, g.Wait())
+
+	for _, s := range []pipe.Stream{ds, ls} {
+		if s != nil {
+			assert.NoError(t, s.Close())
+		}
+	}
+}
+
+// exchange sends a message on the stream, and checks the one it receives
+func exchange(name string, s pipe.Stream, send, recv string) error {
+	var g errgroup.Group
+	g.Go(func() error {
+		_, err := io.Copy(s, bytes.NewBufferString(send))
+		return errors.Wrap(err, name+" send")
+	})
+
+	g.Go(func() error {
+		buf := new(bytes.Buffer)
+		if _, err := io.Copy(buf, io.LimitReader(s, int64(len(recv)))); err != nil {
+			return errors.Wrap(err, name+" recv")
+		}
+
+		if buf.String() != recv {
+			return errors.Errorf("%s recv: expected %q, got %q", name, recv, buf.String())
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
@@ -0,0 +1,129 @@
+// Package mplex implements the mplex stream multiplexer, as specified by libp2p.
+//
+// Frames consist of a uvarint header (stream ID << 3 | flag), a uvarint length,
+// and a payload.  Unlike yamux, mplex has no flow control.  A stream whose reader
+// falls behind by more than Config.MaxBufferedMessages messages for longer than
+// Config.ReceiveTimeout is reset.
+package mplex
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	flagNewStream byte = iota
+	flagMessageReceiver
+	flagMessageInitiator
+	flagCloseReceiver
+	flagCloseInitiator
+	flagResetReceiver
+	flagResetInitiator
+)
+
+var (
+	// ErrSessionShutdown is returned when using a closed session
+	ErrSessionShutdown = errors.New("session shutdown")
+
+	// ErrStreamReset is returned when using a stream that was reset
+	ErrStreamReset = errors.New("stream reset")
+
+	// ErrStreamClosed is returned when writing to a closed stream
+	ErrStreamClosed = errors.New("stream closed")
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// ErrTimeout is returned when a deadline is exceeded.  It satisfies net.Error.
+var ErrTimeout net.Error = timeoutError{}
+
+// Config is used to tune an mplex session
+type Config struct {
+	// AcceptBacklog is the number of inbound streams that can be pending a call
+	// to AcceptStream.  Further inbound streams are reset.
+	AcceptBacklog int
+
+	// MaxMessageSize is the largest payload that will be sent or accepted in a
+	// single frame.
+	MaxMessageSize int
+
+	// MaxBufferedMessages is the number of messages that can be buffered for
+	// each stream before the session blocks.
+	MaxBufferedMessages int
+
+	// ReceiveTimeout is how long the session blocks on a stream whose buffer
+	// is full before resetting it.
+	ReceiveTimeout time.Duration
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		AcceptBacklog:       256,
+		MaxMessageSize:      1 << 20,
+		MaxBufferedMessages: 16,
+		ReceiveTimeout:      5 * time.Second,
+	}
+}
+
+// VerifyConfig checks the sanity of the configuration
+func VerifyConfig(c *Config) error {
+	if c.AcceptBacklog <= 0 {
+		return errors.New("backlog must be positive")
+	}
+
+	if c.MaxMessageSize <= 0 {
+		return errors.New("max message size must be positive")
+	}
+
+	if c.MaxBufferedMessages <= 0 {
+		return errors.New("max buffered messages must be positive")
+	}
+
+	if c.ReceiveTimeout <= 0 {
+		return errors.New("receive timeout must be positive")
+	}
+
+	return nil
+}
+
+// Client session over the connection.  Client-initiated streams have
+// even-numbered IDs.
+func Client(conn net.Conn, c *Config) (*Session, error) {
+	return newSession(conn, c, 0)
+}
+
+// Server session over the connection.  Server-initiated streams have
+// odd-numbered IDs.
+func Server(conn net.Conn, c *Config) (*Session, error) {
+	return newSession(conn, c, 1)
+}
+
+func newSession(conn net.Conn, c *Config, firstID uint64) (*Session, error) {
+	if c == nil {
+		c = DefaultConfig()
+	}
+
+	if err := VerifyConfig(c); err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		conn:    conn,
+		c:       c,
+		nextID:  firstID,
+		wlock:   make(chan struct{}, 1),
+		accept:  make(chan *Stream, c.AcceptBacklog),
+		die:     make(chan struct{}),
+		streams: make(map[streamKey]*Stream),
+	}
+
+	go s.recvLoop()
+	return s, nil
+}
@@ -0,0 +1,147 @@
+package mplex
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func mkSessions(t *testing.T, c *Config) (client, server *Session) {
+	dc, lc := net.Pipe()
+
+	client, err := Client(dc, c)
+	assert.NoError(t, err)
+
+	server, err = Server(lc, c)
+	assert.NoError(t, err)
+
+	return
+}
+
+func mkStreams(t *testing.T, client, server *Session) (ds, ls *Stream) {
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		ds, err = client.OpenStream()
+		return
+	})
+	g.Go(func() (err error) {
+		ls, err = server.AcceptStream()
+		return
+	})
+	assert.NoError(t, g.Wait())
+	return
+}
+
+func TestConfig(t *testing.T) {
+	assert.NoError(t, VerifyConfig(DefaultConfig()))
+	assert.Error(t, VerifyConfig(new(Config)))
+
+	_, err := Client(nil, new(Config))
+	assert.Error(t, err)
+
+	_, err = Server(nil, new(Config))
+	assert.Error(t, err)
+}
+
+func TestSession(t *testing.T) {
+	client, server := mkSessions(t, nil)
+
+	t.Run("StreamID", func(t *testing.T) {
+		ds, ls := mkStreams(t, client, server)
+		assert.Equal(t, ds.ID(), ls.ID())
+		assert.Equal(t, uint64(0), ds.ID()%2, "client stream ID must be even")
+
+		ls, ds = mkStreams(t, server, client)
+		assert.Equal(t, uint64(1), ls.ID()%2, "server stream ID must be odd")
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		assert.NoError(t, client.Close())
+		assert.True(t, client.IsClosed())
+
+		select {
+		case <-server.CloseChan():
+		case <-time.After(time.Second):
+			t.Error("remote session not closed")
+		}
+
+		_, err := client.OpenStream()
+		assert.Equal(t, ErrSessionShutdown, err)
+
+		_, err = server.AcceptStream()
+		assert.Equal(t, ErrSessionShutdown, err)
+	})
+}
+
+func TestStream(t *testing.T) {
+	c := DefaultConfig()
+	c.MaxMessageSize = 4 // exercise chunking
+	client, server := mkSessions(t, c)
+	defer client.Close()
+
+	t.Run("ReadWrite", func(t *testing.T) {
+		ds, ls := mkStreams(t, client, server)
+		msg := []byte("hello, world")
+
+		var g errgroup.Group
+		g.Go(func() error {
+			if _, err := ds.Write(msg); err != nil {
+				return err
+			}
+			return ds.CloseWrite()
+		})
+
+		b, err := ioutil.ReadAll(ls)
+		assert.NoError(t, err)
+		assert.Equal(t, msg, b)
+		assert.NoError(t, g.Wait())
+
+		t.Run("HalfClosed", func(t *testing.T) {
+			_, err := ds.Write(msg)
+			assert.Equal(t, ErrStreamClosed, err)
+
+			g.Go(func() error {
+				_, err := ls.Write(msg)
+				return err
+			})
+
+			b := make([]byte, len(msg))
+			_, err = io.ReadFull(ds, b)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(msg, b))
+			assert.NoError(t, g.Wait())
+		})
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		ds, ls := mkStreams(t, client, server)
+		assert.NoError(t, ds.Reset())
+
+		_, err := ds.Write([]byte("hello"))
+		assert.Equal(t, ErrStreamReset, err)
+
+		_, err = ls.Read(make([]byte, 1))
+		assert.Equal(t, ErrStreamReset, err)
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		ds, _ := mkStreams(t, client, server)
+		assert.NoError(t, ds.SetReadDeadline(time.Now().Add(time.Millisecond)))
+
+		_, err := ds.Read(make([]byte, 1))
+		assert.Equal(t, ErrTimeout, err)
+		assert.True(t, err.(net.Error).Timeout())
+
+		assert.NoError(t, ds.SetReadDeadline(time.Time{}))
+		assert.NoError(t, ds.Close())
+
+		_, err = ds.Read(make([]byte, 1))
+		assert.Equal(t, ErrStreamClosed, err)
+	})
+}
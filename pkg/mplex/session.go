@@ -0,0 +1,251 @@
+package mplex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// streamKey identifies a stream.  Stream IDs are allocated independently by
+// each peer, so the initiator is needed to disambiguate them.
+type streamKey struct {
+	id        uint64
+	initiator bool // true if the local peer opened the stream
+}
+
+// Session multiplexes streams over a net.Conn
+type Session struct {
+	conn net.Conn
+	c    *Config
+
+	wlock chan struct{} // serializes writes; a channel so that it can be selected on
+
+	mu      sync.Mutex
+	nextID  uint64
+	streams map[streamKey]*Stream
+
+	accept chan *Stream
+
+	o   sync.Once
+	die chan struct{}
+}
+
+// LocalAddr of the underlying connection
+func (s *Session) LocalAddr() net.Addr { return s.conn.LocalAddr() }
+
+// RemoteAddr of the underlying connection
+func (s *Session) RemoteAddr() net.Addr { return s.conn.RemoteAddr() }
+
+// CloseChan is closed when the session is shut down
+func (s *Session) CloseChan() <-chan struct{} { return s.die }
+
+// IsClosed reports whether the session is shut down
+func (s *Session) IsClosed() bool { return isClosed(s.die) }
+
+// Close the session and all of its streams
+func (s *Session) Close() (err error) {
+	err = ErrSessionShutdown
+	s.o.Do(func() {
+		close(s.die)
+		err = s.conn.Close()
+	})
+	return
+}
+
+// OpenStream creates a new stream
+func (s *Session) OpenStream() (*Stream, error) {
+	if s.IsClosed() {
+		return nil, ErrSessionShutdown
+	}
+
+	s.mu.Lock()
+	id := s.nextID
+	s.nextID += 2
+	strm := newStream(s, streamKey{id: id, initiator: true})
+	s.streams[strm.key] = strm
+	s.mu.Unlock()
+
+	name := strconv.FormatUint(id, 10)
+	if err := s.writeFrame(id, flagNewStream, []byte(name), nil); err != nil {
+		s.release(strm.key)
+		return nil, err
+	}
+
+	return strm, nil
+}
+
+// AcceptStream blocks until the remote peer opens a stream
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case strm := <-s.accept:
+		return strm, nil
+	case <-s.die:
+		return nil, ErrSessionShutdown
+	}
+}
+
+func (s *Session) release(k streamKey) {
+	s.mu.Lock()
+	delete(s.streams, k)
+	s.mu.Unlock()
+}
+
+func (s *Session) writeFrame(id uint64, flag byte, b []byte, deadline <-chan struct{}) error {
+	select {
+	case s.wlock <- struct{}{}:
+		defer func() { <-s.wlock }()
+	case <-deadline:
+		return ErrTimeout
+	case <-s.die:
+		return ErrSessionShutdown
+	}
+
+	hdr := make([]byte, 2*binary.MaxVarintLen64, 2*binary.MaxVarintLen64+len(b))
+	n := binary.PutUvarint(hdr, id<<3|uint64(flag))
+	n += binary.PutUvarint(hdr[n:], uint64(len(b)))
+
+	if _, err := s.conn.Write(append(hdr[:n], b...)); err != nil {
+		s.Close()
+		return errors.Wrap(err, "write")
+	}
+
+	return nil
+}
+
+func (s *Session) recvLoop() {
+	defer s.Close()
+
+	r := bufio.NewReader(s.conn)
+	for {
+		h, err := binary.ReadUvarint(r)
+		if err != nil {
+			return
+		}
+
+		size, err := binary.ReadUvarint(r)
+		if err != nil || size > uint64(s.c.MaxMessageSize) {
+			return
+		}
+
+		b := make([]byte, size)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return
+		}
+
+		s.handleFrame(h>>3, byte(h&7), b)
+	}
+}
+
+func (s *Session) handleFrame(id uint64, flag byte, b []byte) {
+	if flag == flagNewStream {
+		s.handleNewStream(id)
+		return
+	}
+
+	// Frames flagged "initiator" were sent by the peer that opened the stream,
+	// i.e. the remote one.
+	k := streamKey{id: id}
+	switch flag {
+	case flagMessageReceiver, flagCloseReceiver, flagResetReceiver:
+		k.initiator = true
+	}
+
+	s.mu.Lock()
+	strm, ok := s.streams[k]
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	switch flag {
+	case flagMessageReceiver, flagMessageInitiator:
+		strm.push(b, s.c.ReceiveTimeout)
+	case flagCloseReceiver, flagCloseInitiator:
+		strm.remoteClose()
+	case flagResetReceiver, flagResetInitiator:
+		strm.remoteReset()
+	}
+}
+
+func (s *Session) handleNewStream(id uint64) {
+	strm := newStream(s, streamKey{id: id})
+
+	s.mu.Lock()
+	_, exists := s.streams[strm.key]
+	if !exists {
+		s.streams[strm.key] = strm
+	}
+	s.mu.Unlock()
+
+	if exists {
+		return
+	}
+
+	select {
+	case s.accept <- strm:
+	default:
+		strm.Reset() // backlog full
+	}
+}
+
+// deadline is closed when a deadline is exceeded.
+type deadline struct {
+	mu     sync.Mutex
+	t      *time.Timer
+	cancel chan struct{}
+}
+
+func newDeadline() *deadline { return &deadline{cancel: make(chan struct{})} }
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.t != nil && !d.t.Stop() {
+		<-d.cancel // wait for the timer callback to finish and close cancel
+	}
+	d.t = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.t = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
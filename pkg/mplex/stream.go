@@ -0,0 +1,226 @@
+package mplex
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Stream is a bidirectional stream multiplexed over a Session.  It satisfies
+// net.Conn.
+type Stream struct {
+	key  streamKey
+	sess *Session
+
+	rmu  sync.Mutex
+	buf  []byte
+	recv chan []byte
+
+	rdl, wdl *deadline
+
+	finO, closeO, wcloseO, rstO sync.Once
+	fin                         chan struct{} // remote closed its write side
+	closed                      chan struct{} // local read side closed
+	wclosed                     chan struct{} // local write side closed
+	rst                         chan struct{} // stream was reset
+}
+
+func newStream(s *Session, k streamKey) *Stream {
+	return &Stream{
+		key:     k,
+		sess:    s,
+		recv:    make(chan []byte, s.c.MaxBufferedMessages),
+		rdl:     newDeadline(),
+		wdl:     newDeadline(),
+		fin:     make(chan struct{}),
+		closed:  make(chan struct{}),
+		wclosed: make(chan struct{}),
+		rst:     make(chan struct{}),
+	}
+}
+
+// ID of the stream, as allocated by the peer that opened it
+func (s *Stream) ID() uint64 { return s.key.id }
+
+// StreamID truncates the stream ID to 32 bits
+func (s *Stream) StreamID() uint32 { return uint32(s.key.id) }
+
+// LocalAddr of the underlying connection
+func (s *Stream) LocalAddr() net.Addr { return s.sess.LocalAddr() }
+
+// RemoteAddr of the underlying connection
+func (s *Stream) RemoteAddr() net.Addr { return s.sess.RemoteAddr() }
+
+func (s *Stream) flag(receiver, initiator byte) byte {
+	if s.key.initiator {
+		return initiator
+	}
+	return receiver
+}
+
+// Read data from the stream
+func (s *Stream) Read(b []byte) (int, error) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+
+	for len(s.buf) == 0 {
+		select {
+		case s.buf = <-s.recv:
+			continue
+		default:
+		}
+
+		select {
+		case s.buf = <-s.recv:
+		case <-s.fin:
+			// All data preceding the close frame has already been pushed.
+			select {
+			case s.buf = <-s.recv:
+			default:
+				return 0, io.EOF
+			}
+		case <-s.closed:
+			return 0, ErrStreamClosed
+		case <-s.rst:
+			return 0, ErrStreamReset
+		case <-s.sess.die:
+			return 0, ErrSessionShutdown
+		case <-s.rdl.wait():
+			return 0, ErrTimeout
+		}
+	}
+
+	n := copy(b, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// Write data to the stream.  Writes larger than Config.MaxMessageSize are split
+// across several frames.
+func (s *Stream) Write(b []byte) (n int, err error) {
+	flag := s.flag(flagMessageReceiver, flagMessageInitiator)
+
+	for len(b) > 0 {
+		select {
+		case <-s.wclosed:
+			return n, ErrStreamClosed
+		case <-s.rst:
+			return n, ErrStreamReset
+		default:
+		}
+
+		chunk := b
+		if len(chunk) > s.sess.c.MaxMessageSize {
+			chunk = chunk[:s.sess.c.MaxMessageSize]
+		}
+
+		if err = s.sess.writeFrame(s.key.id, flag, chunk, s.wdl.wait()); err != nil {
+			return
+		}
+
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+
+	return
+}
+
+// CloseWrite closes the write side of the stream.  The remote peer reads io.EOF
+// once it has consumed the data in flight.
+func (s *Stream) CloseWrite() (err error) {
+	err = ErrStreamClosed
+	s.wcloseO.Do(func() {
+		close(s.wclosed)
+		err = s.sess.writeFrame(s.key.id, s.flag(flagCloseReceiver, flagCloseInitiator), nil, nil)
+		s.maybeRelease()
+	})
+	return
+}
+
+// Close both sides of the stream.  Data subsequently received from the remote
+// peer is discarded.
+func (s *Stream) Close() error {
+	s.closeO.Do(func() { close(s.closed) })
+
+	if err := s.CloseWrite(); err != ErrStreamClosed {
+		return err
+	}
+
+	return nil
+}
+
+// Reset aborts the stream in both directions
+func (s *Stream) Reset() (err error) {
+	err = ErrStreamReset
+	s.rstO.Do(func() {
+		close(s.rst)
+		err = s.sess.writeFrame(s.key.id, s.flag(flagResetReceiver, flagResetInitiator), nil, nil)
+		s.sess.release(s.key)
+	})
+	return
+}
+
+// SetDeadline sets the read and write deadlines
+func (s *Stream) SetDeadline(t time.Time) error {
+	s.rdl.set(t)
+	s.wdl.set(t)
+	return nil
+}
+
+// SetReadDeadline sets the read deadline
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.rdl.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	s.wdl.set(t)
+	return nil
+}
+
+// push data received from the remote peer.  Blocks for up to timeout if the
+// receive buffer is full, after which the stream is reset.
+func (s *Stream) push(b []byte, timeout time.Duration) {
+	select {
+	case s.recv <- b:
+		return
+	case <-s.closed:
+		return
+	case <-s.rst:
+		return
+	default:
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case s.recv <- b:
+	case <-s.closed:
+	case <-s.rst:
+	case <-s.sess.die:
+	case <-t.C:
+		s.Reset()
+	}
+}
+
+func (s *Stream) remoteClose() {
+	s.finO.Do(func() { close(s.fin) })
+	s.maybeRelease()
+}
+
+func (s *Stream) remoteReset() {
+	s.rstO.Do(func() {
+		close(s.rst)
+		s.sess.release(s.key)
+	})
+}
+
+// maybeRelease removes the stream from the session once both sides are closed
+func (s *Stream) maybeRelease() {
+	if isClosed(s.fin) && isClosed(s.wclosed) {
+		s.sess.release(s.key)
+	}
+}
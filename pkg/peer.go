@@ -0,0 +1,75 @@
+package pipe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+// PeerID identifies a peer independently of its network address.  It is either
+// a public key, or derived from one.
+type PeerID []byte
+
+func (id PeerID) String() string { return hex.EncodeToString(id) }
+
+// Equal reports whether both IDs identify the same peer
+func (id PeerID) Equal(other PeerID) bool { return bytes.Equal(id, other) }
+
+// CertPeerID derives a PeerID from the SHA-256 digest of the certificate's public
+// key.  The ID is therefore stable across certificate renewals, so long as the
+// key is unchanged.
+func CertPeerID(cert *x509.Certificate) PeerID {
+	if cert == nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+// TLSPeerID derives the local PeerID from the certificate that the config
+// presents, as in CertPeerID.  Servers pass the ClientHello, or an approximation
+// of it, so that the certificate can be obtained from GetCertificate as
+// crypto/tls would; clients pass nil.  Otherwise, the first of the config's
+// Certificates is used.  TLSPeerID returns nil if there is no certificate, or if
+// it cannot be parsed.
+func TLSPeerID(c *tls.Config, hello *tls.ClientHelloInfo) PeerID {
+	if c == nil {
+		return nil
+	}
+
+	var cert *tls.Certificate
+	if hello != nil && c.GetCertificate != nil && (len(c.Certificates) == 0 || hello.ServerName != "") {
+		cert, _ = c.GetCertificate(hello)
+	}
+
+	if cert == nil && len(c.Certificates) > 0 {
+		cert = &c.Certificates[0]
+	}
+
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil
+	}
+
+	if cert.Leaf != nil {
+		return CertPeerID(cert.Leaf)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil
+	}
+
+	return CertPeerID(leaf)
+}
+
+// IdentifiedConn is a Conn that knows the identity of the peers at either end.
+// It is implemented by transports that authenticate peers.  Either method
+// returns nil if the corresponding peer is anonymous.
+type IdentifiedConn interface {
+	Conn
+	LocalPeer() PeerID
+	RemotePeer() PeerID
+}
@@ -0,0 +1,59 @@
+package pipe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerID(t *testing.T) {
+	id := PeerID{0xde, 0xad, 0xbe, 0xef}
+	assert.Equal(t, "deadbeef", id.String())
+	assert.True(t, id.Equal(PeerID{0xde, 0xad, 0xbe, 0xef}))
+	assert.False(t, id.Equal(nil))
+
+	t.Run("CertPeerID", func(t *testing.T) {
+		assert.Nil(t, CertPeerID(nil))
+
+		a := CertPeerID(&x509.Certificate{RawSubjectPublicKeyInfo: []byte("key")})
+		b := CertPeerID(&x509.Certificate{RawSubjectPublicKeyInfo: []byte("key"), Raw: []byte("renewed")})
+		assert.Len(t, a, 32)
+		assert.True(t, a.Equal(b), "ID depends on more than the public key")
+	})
+
+	t.Run("TLSPeerID", func(t *testing.T) {
+		assert.Nil(t, TLSPeerID(nil, nil))
+		assert.Nil(t, TLSPeerID(&tls.Config{}, nil))
+		assert.Nil(t, TLSPeerID(&tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{[]byte("garbage")}}},
+		}, nil))
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+
+		tmpl := &x509.Certificate{SerialNumber: big.NewInt(1)}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		assert.NoError(t, err)
+
+		leaf, err := x509.ParseCertificate(der)
+		assert.NoError(t, err)
+
+		cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+		assert.Equal(t, CertPeerID(leaf), TLSPeerID(&tls.Config{Certificates: []tls.Certificate{cert}}, nil))
+
+		cert.Leaf = leaf
+		assert.Equal(t, CertPeerID(leaf), TLSPeerID(&tls.Config{Certificates: []tls.Certificate{cert}}, nil))
+
+		getCert := &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil },
+		}
+		assert.Equal(t, CertPeerID(leaf), TLSPeerID(getCert, &tls.ClientHelloInfo{}))
+		assert.Nil(t, TLSPeerID(getCert, nil), "clients do not call GetCertificate")
+	})
+}
@@ -32,12 +32,19 @@ type Conn interface {
 }
 
 // Stream is a bidirectional connection between two hosts.
+//
+// CloseWrite shuts down the writing side of the stream.  The remote end reads
+// io.EOF once it has consumed any data in flight, but may continue writing.
+// CloseRead shuts down the reading side of the stream.  Subsequent calls to
+// Read return an error.  Close shuts down both sides.
 type Stream interface {
 	Context() context.Context
 	StreamID() uint32
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 	Close() error
+	CloseRead() error
+	CloseWrite() error
 	Read([]byte) (int, error)
 	Write([]byte) (int, error)
 	SetDeadline(time.Time) error
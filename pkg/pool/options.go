@@ -0,0 +1,26 @@
+package pool
+
+import "time"
+
+// Option for Pool
+type Option func(*Pool) (prev Option)
+
+// OptIdleTimeout sets the time after which a connection with no open streams is
+// closed.  Zero disables the timeout.
+func OptIdleTimeout(d time.Duration) Option {
+	return func(p *Pool) (prev Option) {
+		prev = OptIdleTimeout(p.idleTimeout)
+		p.idleTimeout = d
+		return
+	}
+}
+
+// OptDialTimeout bounds the time spent establishing a connection.  Zero disables
+// the timeout.
+func OptDialTimeout(d time.Duration) Option {
+	return func(p *Pool) (prev Option) {
+		prev = OptDialTimeout(p.dialTimeout)
+		p.dialTimeout = d
+		return
+	}
+}
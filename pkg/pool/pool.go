@@ -0,0 +1,251 @@
+// Package pool shares connections among callers that open streams to the same
+// remote peer.  Since streams are multiplexed, a single pipe.Conn per peer is
+// usually sufficient.
+package pool
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultIdleTimeout after which a connection with no open streams is closed
+	DefaultIdleTimeout = 90 * time.Second
+
+	// DefaultDialTimeout bounds the time spent establishing a connection
+	DefaultDialTimeout = 30 * time.Second
+)
+
+// ErrClosed is returned when opening a stream on a closed Pool
+var ErrClosed = errors.New("pool: closed")
+
+type key struct{ network, address string }
+
+type entry struct {
+	ready chan struct{} // closed once the dial completes
+	conn  pipe.Conn
+	err   error
+
+	streams int // open, or being opened
+	idle    *time.Timer
+}
+
+// Pool of connections dialed by a transport, keyed by remote address.
+// Connections are evicted when their context expires, or when they have had no
+// open streams for the idle timeout.  Concurrent callers share a single dial.
+//
+// Streams opened by the remote peer on pooled connections are not accepted.
+type Pool struct {
+	t           pipe.Transport
+	idleTimeout time.Duration
+	dialTimeout time.Duration
+
+	ctx    context.Context
+	cancel func()
+
+	mu    sync.Mutex
+	conns map[key]*entry // nil once closed
+}
+
+// New Pool of connections dialed by the transport
+func New(t pipe.Transport, opt ...Option) *Pool {
+	p := &Pool{
+		t:           t,
+		idleTimeout: DefaultIdleTimeout,
+		dialTimeout: DefaultDialTimeout,
+		conns:       make(map[key]*entry),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	for _, fn := range opt {
+		fn(p)
+	}
+
+	return p
+}
+
+// OpenStream to the remote address, over a pooled connection.  A connection is
+// dialed if none is open.  Streams must be closed, so that idle connections can
+// be evicted.
+func (p *Pool) OpenStream(c context.Context, a net.Addr) (pipe.Stream, error) {
+	k := key{network: a.Network(), address: a.String()}
+
+	e, err := p.get(c, k, a)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := e.conn.OpenStream()
+	if err != nil {
+		p.release(k, e)
+		p.evict(k, e)
+		return nil, errors.Wrap(err, "open stream")
+	}
+
+	return &stream{Stream: s, release: func() { p.release(k, e) }}, nil
+}
+
+// get a connection, reserving a stream on it
+func (p *Pool) get(c context.Context, k key, a net.Addr) (*entry, error) {
+	p.mu.Lock()
+	if p.conns == nil {
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+
+	e, ok := p.conns[k]
+	if !ok {
+		e = &entry{ready: make(chan struct{})}
+		p.conns[k] = e
+		go p.dial(k, e, a)
+	}
+
+	e.streams++
+	if e.idle != nil {
+		e.idle.Stop()
+		e.idle = nil
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-e.ready:
+	case <-c.Done():
+		p.release(k, e)
+		return nil, c.Err()
+	}
+
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return e, nil
+}
+
+// dial on behalf of every caller waiting on the entry.  Callers may give up
+// without canceling the dial, which completes for the benefit of later callers.
+func (p *Pool) dial(k key, e *entry, a net.Addr) {
+	c, cancel := p.ctx, func() {}
+	if p.dialTimeout > 0 {
+		c, cancel = context.WithTimeout(c, p.dialTimeout)
+	}
+	defer cancel()
+
+	conn, err := p.t.Dial(c, a)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer close(e.ready)
+
+	if err != nil {
+		e.err = errors.Wrap(err, "dial")
+		if p.conns != nil && p.conns[k] == e {
+			delete(p.conns, k)
+		}
+		return
+	}
+
+	if p.conns == nil {
+		conn.Close()
+		e.err = ErrClosed
+		return
+	}
+
+	e.conn = conn
+	if e.streams == 0 {
+		p.startIdle(k, e)
+	}
+
+	go func() {
+		<-conn.Context().Done()
+		p.evict(k, e)
+	}()
+}
+
+// release a stream reserved by get.  The idle timer is started when the last
+// stream is released.
+func (p *Pool) release(k key, e *entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e.streams--; e.streams == 0 && e.conn != nil {
+		p.startIdle(k, e)
+	}
+}
+
+// startIdle timer.  The caller must hold the lock.
+func (p *Pool) startIdle(k key, e *entry) {
+	if p.idleTimeout <= 0 {
+		return
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(p.idleTimeout, func() {
+		p.mu.Lock()
+		expired := e.idle == t && e.streams == 0
+		p.mu.Unlock()
+
+		if expired {
+			p.evict(k, e)
+		}
+	})
+	e.idle = t
+}
+
+// evict the entry's connection from the pool, and close it
+func (p *Pool) evict(k key, e *entry) {
+	p.mu.Lock()
+	if p.conns != nil && p.conns[k] == e {
+		delete(p.conns, k)
+	}
+
+	if e.idle != nil {
+		e.idle.Stop()
+		e.idle = nil
+	}
+	p.mu.Unlock()
+
+	e.conn.Close()
+}
+
+// Close the pool, along with its connections.  Pending dials are aborted.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = nil
+	p.mu.Unlock()
+
+	if conns == nil {
+		return ErrClosed
+	}
+
+	p.cancel()
+
+	for k, e := range conns {
+		select {
+		case <-e.ready:
+			if e.conn != nil {
+				p.evict(k, e)
+			}
+		default: // the dial closes the connection
+		}
+	}
+
+	return nil
+}
+
+// stream releases its reservation on the connection when closed
+type stream struct {
+	pipe.Stream
+	o       sync.Once
+	release func()
+}
+
+func (s *stream) Close() error {
+	s.o.Do(s.release)
+	return s.Stream.Close()
+}
@@ -0,0 +1,218 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/inproc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// tp is shared by all tests in order to synchronize access to the inproc
+// DefaultNamespace.
+var tp = inproc.New()
+
+// countingTransport counts dials, which are delayed
+type countingTransport struct {
+	pipe.Transport
+	delay  time.Duration
+	dialed int32
+}
+
+func (t *countingTransport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
+	atomic.AddInt32(&t.dialed, 1)
+	time.Sleep(t.delay)
+	return t.Transport.Dial(c, a)
+}
+
+func (t *countingTransport) dials() int { return int(atomic.LoadInt32(&t.dialed)) }
+
+// listen returns a channel of accepted connections, whose streams are accepted
+// and discarded.
+func listen(t *testing.T, a net.Addr) (pipe.Listener, <-chan pipe.Conn) {
+	l, err := tp.Listen(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan pipe.Conn, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+
+			go func() {
+				for {
+					s, err := conn.AcceptStream()
+					if err != nil {
+						return
+					}
+					s.Close()
+				}
+			}()
+		}
+	}()
+
+	return l, accepted
+}
+
+func TestShared(t *testing.T) {
+	a := inproc.Addr("/pool/shared")
+	l, accepted := listen(t, a)
+	defer l.Close()
+
+	ct := &countingTransport{Transport: tp, delay: 10 * time.Millisecond}
+	p := New(ct)
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s, err := p.OpenStream(context.Background(), a)
+			if assert.NoError(t, err) {
+				s.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, ct.dials(), "concurrent dials not deduplicated")
+	assert.Len(t, accepted, 1)
+}
+
+func TestEvict(t *testing.T) {
+	a := inproc.Addr("/pool/evict")
+	l, accepted := listen(t, a)
+	defer l.Close()
+
+	p := New(tp)
+	defer p.Close()
+
+	s, err := p.OpenStream(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.Close()
+
+	conn := <-accepted
+	conn.Close()
+
+	// the pool notices that the connection was lost
+	for deadline := time.Now().Add(time.Second); len(accepted) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("connection not redialed")
+		}
+
+		if s, err := p.OpenStream(context.Background(), a); err == nil {
+			s.Close()
+		}
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	a := inproc.Addr("/pool/idle")
+	l, accepted := listen(t, a)
+	defer l.Close()
+
+	p := New(tp, OptIdleTimeout(20*time.Millisecond))
+	defer p.Close()
+
+	s, err := p.OpenStream(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn := <-accepted
+
+	// not idle while a stream is open
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, conn.Context().Err())
+
+	s.Close()
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(time.Second):
+		t.Error("idle connection not closed")
+	}
+}
+
+func TestDialError(t *testing.T) {
+	a := inproc.Addr("/pool/error")
+
+	ct := &countingTransport{Transport: tp}
+	p := New(ct)
+	defer p.Close()
+
+	_, err := p.OpenStream(context.Background(), a)
+	assert.Error(t, err)
+
+	// failures are not cached
+	l, _ := listen(t, a)
+	defer l.Close()
+
+	s, err := p.OpenStream(context.Background(), a)
+	if assert.NoError(t, err) {
+		s.Close()
+	}
+	assert.Equal(t, 2, ct.dials())
+}
+
+func TestContextExpired(t *testing.T) {
+	a := inproc.Addr("/pool/context")
+	l, _ := listen(t, a)
+	defer l.Close()
+
+	ct := &countingTransport{Transport: tp, delay: 50 * time.Millisecond}
+	p := New(ct)
+	defer p.Close()
+
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := p.OpenStream(c, a)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+	// the dial completes for the next caller
+	s, err := p.OpenStream(context.Background(), a)
+	if assert.NoError(t, err) {
+		s.Close()
+	}
+	assert.Equal(t, 1, ct.dials())
+}
+
+func TestClose(t *testing.T) {
+	a := inproc.Addr("/pool/close")
+	l, accepted := listen(t, a)
+	defer l.Close()
+
+	p := New(tp)
+
+	s, err := p.OpenStream(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	assert.NoError(t, p.Close())
+	assert.Equal(t, ErrClosed, p.Close())
+
+	select {
+	case <-(<-accepted).Context().Done():
+	case <-time.After(time.Second):
+		t.Error("connection not closed")
+	}
+
+	_, err = p.OpenStream(context.Background(), a)
+	assert.Equal(t, ErrClosed, err)
+}
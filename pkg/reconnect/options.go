@@ -0,0 +1,36 @@
+package reconnect
+
+import "github.com/jpillora/backoff"
+
+// Option for reconnecting Conn
+type Option func(*Conn) (prev Option)
+
+// OptBackoff sets the backoff policy applied between successive dial attempts.
+// Jitter is enabled by default.  Dial fails if b is nil.
+func OptBackoff(b *backoff.Backoff) Option {
+	return func(c *Conn) (prev Option) {
+		prev = OptBackoff(c.b)
+		c.b = b
+		return
+	}
+}
+
+// OptFailFast causes OpenStream to return ErrDisconnected instead of blocking
+// while the connection is being re-established.
+func OptFailFast(failFast bool) Option {
+	return func(c *Conn) (prev Option) {
+		prev = OptFailFast(c.failFast)
+		c.failFast = failFast
+		return
+	}
+}
+
+// OptNotify sets a callback that is invoked on each state change.  Callbacks are
+// invoked sequentially from a single goroutine, and should not block.
+func OptNotify(f func(State)) Option {
+	return func(c *Conn) (prev Option) {
+		prev = OptNotify(c.notify)
+		c.notify = f
+		return
+	}
+}
@@ -0,0 +1,255 @@
+// Package reconnect provides a pipe.Conn that transparently redials its remote
+// peer when the underlying connection is lost.
+package reconnect
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+)
+
+// ErrDisconnected is returned by OpenStream when the connection is being
+// re-established and OptFailFast is set.
+var ErrDisconnected = errors.New("reconnect: disconnected")
+
+// State of a reconnecting Conn
+type State uint8
+
+const (
+	// StateConnecting indicates that the remote peer is being dialed
+	StateConnecting State = iota
+	// StateConnected indicates that a connection to the remote peer is open
+	StateConnected
+	// StateDisconnected indicates that the connection to the remote peer was
+	// lost, or that the Conn was closed
+	StateDisconnected
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	default:
+		return "invalid"
+	}
+}
+
+// Conn is a pipe.Conn that redials the remote peer whenever the context of the
+// underlying connection expires.  Streams that were open on the underlying
+// connection are not recovered.
+type Conn struct {
+	o      sync.Once
+	ctx    context.Context
+	cancel func()
+
+	t pipe.Transport
+	a net.Addr
+
+	b        *backoff.Backoff
+	failFast bool
+	notify   func(State)
+
+	mu      sync.RWMutex
+	state   State
+	conn    pipe.Conn
+	changed chan struct{} // closed and replaced whenever conn changes
+}
+
+// Dial the remote address using the supplied transport.  Dial blocks until the
+// first connection is established, or until the context expires.
+func Dial(c context.Context, t pipe.Transport, a net.Addr, opt ...Option) (*Conn, error) {
+	conn := &Conn{
+		t:       t,
+		a:       a,
+		b:       &backoff.Backoff{Jitter: true},
+		notify:  func(State) {},
+		changed: make(chan struct{}),
+	}
+	conn.ctx, conn.cancel = context.WithCancel(context.Background())
+
+	for _, fn := range opt {
+		fn(conn)
+	}
+
+	if conn.b == nil {
+		conn.cancel()
+		return nil, errors.New("dial: nil backoff")
+	}
+
+	// The first change is always to the first connection.
+	_, changed := conn.current()
+	go conn.loop()
+
+	select {
+	case <-changed:
+		return conn, nil
+	case <-c.Done():
+		conn.Close()
+		return nil, errors.Wrap(c.Err(), "dial")
+	}
+}
+
+func (c *Conn) loop() {
+	for {
+		c.setState(StateConnecting, nil)
+
+		conn, ok := c.dial()
+		if !ok {
+			c.setState(StateDisconnected, nil)
+			return
+		}
+
+		c.setState(StateConnected, conn)
+
+		select {
+		case <-conn.Context().Done():
+			c.setState(StateDisconnected, nil)
+		case <-c.ctx.Done():
+			conn.Close()
+			c.setState(StateDisconnected, nil)
+			return
+		}
+	}
+}
+
+// dial until a connection is established, or the Conn is closed.
+func (c *Conn) dial() (pipe.Conn, bool) {
+	defer c.b.Reset()
+
+	for {
+		conn, err := c.t.Dial(c.ctx, c.a)
+		if err == nil {
+			return conn, true
+		}
+
+		select {
+		case <-time.After(c.b.Duration()):
+		case <-c.ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func (c *Conn) setState(s State, conn pipe.Conn) {
+	c.mu.Lock()
+	c.state = s
+
+	if conn != c.conn {
+		c.conn = conn
+		close(c.changed)
+		c.changed = make(chan struct{})
+	}
+	c.mu.Unlock()
+
+	c.notify(s)
+}
+
+// current connection, which may be nil, and a channel that is closed when it
+// changes
+func (c *Conn) current() (pipe.Conn, <-chan struct{}) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn, c.changed
+}
+
+// wait for a connection other than stale to become available
+func (c *Conn) wait(failFast bool, stale pipe.Conn) (pipe.Conn, error) {
+	for {
+		conn, changed := c.current()
+		if conn != nil && conn != stale {
+			return conn, nil
+		}
+
+		if failFast {
+			return nil, ErrDisconnected
+		}
+
+		select {
+		case <-changed:
+		case <-c.ctx.Done():
+			return nil, errors.New("closed")
+		}
+	}
+}
+
+// State of the connection
+func (c *Conn) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
+
+// Context expires when the Conn is closed.  It is unaffected by the loss of the
+// underlying connection.
+func (c *Conn) Context() context.Context { return c.ctx }
+
+// LocalAddr of the underlying connection, or nil if disconnected
+func (c *Conn) LocalAddr() net.Addr {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr is the address being dialed
+func (c *Conn) RemoteAddr() net.Addr { return c.a }
+
+// OpenStream on the underlying connection.  If the connection is being
+// re-established, OpenStream blocks until it succeeds, unless OptFailFast is set.
+func (c *Conn) OpenStream() (pipe.Stream, error) {
+	conn, err := c.wait(c.failFast, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.OpenStream()
+}
+
+// AcceptStream from the underlying connection.  AcceptStream continues on the
+// new connection if the current one is lost while waiting.
+func (c *Conn) AcceptStream() (pipe.Stream, error) {
+	var stale pipe.Conn
+	for {
+		conn, err := c.wait(false, stale)
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := conn.AcceptStream()
+		if err == nil {
+			return s, nil
+		}
+
+		// AcceptStream may return before the connection's context expires.
+		// Wait for it, then skip the dead connection until it is replaced.
+		select {
+		case <-conn.Context().Done():
+			stale = conn
+		case <-c.ctx.Done():
+			return nil, errors.Wrap(err, "closed")
+		}
+	}
+}
+
+// Close the connection and stop redialing
+func (c *Conn) Close() (err error) {
+	err = errors.New("already closed")
+	c.o.Do(func() {
+		c.cancel()
+		err = nil
+	})
+	return
+}
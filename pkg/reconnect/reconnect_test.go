@@ -0,0 +1,189 @@
+package reconnect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jpillora/backoff"
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/inproc"
+	"github.com/stretchr/testify/assert"
+)
+
+// tp is shared by all tests in order to synchronize access to the inproc
+// DefaultNamespace.
+var tp = inproc.New()
+
+func fastBackoff() Option {
+	return OptBackoff(&backoff.Backoff{Min: time.Millisecond, Max: time.Millisecond * 10})
+}
+
+func TestState(t *testing.T) {
+	assert.Equal(t, "connecting", StateConnecting.String())
+	assert.Equal(t, "connected", StateConnected.String())
+	assert.Equal(t, "disconnected", StateDisconnected.String())
+	assert.Equal(t, "invalid", State(255).String())
+}
+
+func TestDial(t *testing.T) {
+	t.Run("ContextExpired", func(t *testing.T) {
+		c, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+
+		_, err := Dial(c, tp, inproc.Addr("/nobody"), fastBackoff())
+		assert.Error(t, err)
+	})
+
+	t.Run("NilBackoff", func(t *testing.T) {
+		_, err := Dial(context.Background(), tp, inproc.Addr("/nobody"), OptBackoff(nil))
+		assert.Error(t, err)
+	})
+}
+
+func TestReconnect(t *testing.T) {
+	a := inproc.Addr("/reconnect")
+
+	l, err := tp.Listen(context.Background(), a)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan pipe.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	events := make(chan State, 16)
+	conn, err := Dial(context.Background(), tp, a,
+		fastBackoff(),
+		OptNotify(func(s State) { events <- s }))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, StateConnecting, <-events)
+	assert.Equal(t, StateConnected, <-events)
+	assert.Equal(t, StateConnected, conn.State())
+	assert.Equal(t, a, conn.RemoteAddr())
+
+	svr := <-accepted
+
+	t.Run("OpenStream", func(t *testing.T) {
+		go func() { svr.AcceptStream() }()
+		_, err := conn.OpenStream()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Redial", func(t *testing.T) {
+		assert.NoError(t, svr.Close())
+
+		assert.Equal(t, StateDisconnected, <-events)
+		assert.Equal(t, StateConnecting, <-events)
+		assert.Equal(t, StateConnected, <-events)
+
+		svr = <-accepted
+		go func() { svr.AcceptStream() }()
+		_, err := conn.OpenStream()
+		assert.NoError(t, err)
+		assert.NoError(t, conn.Context().Err())
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		assert.NoError(t, conn.Close())
+		assert.Error(t, conn.Close())
+		assert.Equal(t, StateDisconnected, <-events)
+		assert.Error(t, conn.Context().Err())
+
+		_, err := conn.OpenStream()
+		assert.Error(t, err)
+	})
+}
+
+func TestFailFast(t *testing.T) {
+	a := inproc.Addr("/failfast")
+
+	l, err := tp.Listen(context.Background(), a)
+	assert.NoError(t, err)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		// Drop the connection and stop listening, so that redialing fails.
+		l.Close()
+		conn.Close()
+	}()
+
+	disconnected := make(chan struct{}, 1)
+	conn, err := Dial(context.Background(), tp, a,
+		fastBackoff(),
+		OptFailFast(true),
+		OptNotify(func(s State) {
+			if s == StateDisconnected {
+				select {
+				case disconnected <- struct{}{}:
+				default:
+				}
+			}
+		}))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	<-disconnected
+	_, err = conn.OpenStream()
+	assert.Equal(t, ErrDisconnected, err)
+}
+
+func TestAcceptStream(t *testing.T) {
+	a := inproc.Addr("/accept")
+
+	l, err := tp.Listen(context.Background(), a)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan pipe.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	conn, err := Dial(context.Background(), tp, a, fastBackoff())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	ch := make(chan error, 1)
+	go func() {
+		_, err := conn.AcceptStream()
+		ch <- err
+	}()
+
+	// Drop the first connection while AcceptStream is blocked, then open a
+	// stream from the server side of the second.
+	svr := <-accepted
+	assert.NoError(t, svr.Close())
+
+	svr = <-accepted
+	defer svr.Close()
+
+	_, err = svr.OpenStream()
+	assert.NoError(t, err)
+
+	select {
+	case err := <-ch:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("AcceptStream did not continue on the new connection")
+	}
+}
@@ -0,0 +1,110 @@
+package pipe
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRegistry is a global registry that is used by default.  Transport
+// packages register themselves with it when they are imported.
+var DefaultRegistry = new(Registry)
+
+// Factory produces a Transport and the address it should listen on or dial,
+// given a URL.
+type Factory func(*url.URL) (Transport, net.Addr, error)
+
+// Registry maps URL schemes to transports.  The zero value is ready to use.
+type Registry struct {
+	mu sync.RWMutex
+	m  map[string]Factory
+}
+
+// Register a transport factory for the given URL scheme, replacing any previous
+// registration.
+func (r *Registry) Register(scheme string, f Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.m == nil {
+		r.m = make(map[string]Factory)
+	}
+
+	r.m[strings.ToLower(scheme)] = f
+}
+
+// Resolve a URL into a Transport and address
+func (r *Registry) Resolve(rawurl string) (Transport, net.Addr, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parse url")
+	}
+
+	r.mu.RLock()
+	f, ok := r.m[u.Scheme]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, nil, errors.Errorf("no transport registered for scheme '%s'", u.Scheme)
+	}
+
+	return f(u)
+}
+
+// DialURL resolves the URL and dials the resulting address
+func (r *Registry) DialURL(c context.Context, rawurl string) (Conn, error) {
+	t, a, err := r.Resolve(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Dial(c, a)
+}
+
+// DialAnyURL resolves each URL, and races connection attempts to the resulting
+// addresses.  URLs are attempted in order of preference.  See Dialer.
+func (r *Registry) DialAnyURL(c context.Context, rawurls ...string) (Conn, error) {
+	eps := make([]Endpoint, len(rawurls))
+	for i, rawurl := range rawurls {
+		t, a, err := r.Resolve(rawurl)
+		if err != nil {
+			return nil, errors.Wrap(err, rawurl)
+		}
+
+		eps[i] = Endpoint{Transport: t, Addr: a}
+	}
+
+	return DialAny(c, eps)
+}
+
+// ListenURL resolves the URL and listens on the resulting address
+func (r *Registry) ListenURL(c context.Context, rawurl string) (Listener, error) {
+	t, a, err := r.Resolve(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Listen(c, a)
+}
+
+// Register a transport factory with the DefaultRegistry
+func Register(scheme string, f Factory) { DefaultRegistry.Register(scheme, f) }
+
+// DialURL using the DefaultRegistry
+func DialURL(c context.Context, rawurl string) (Conn, error) {
+	return DefaultRegistry.DialURL(c, rawurl)
+}
+
+// DialAnyURL using the DefaultRegistry
+func DialAnyURL(c context.Context, rawurls ...string) (Conn, error) {
+	return DefaultRegistry.DialAnyURL(c, rawurls...)
+}
+
+// ListenURL using the DefaultRegistry
+func ListenURL(c context.Context, rawurl string) (Listener, error) {
+	return DefaultRegistry.ListenURL(c, rawurl)
+}
@@ -0,0 +1,97 @@
+package pipe
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAddr string
+
+func (mockAddr) Network() string  { return "mock" }
+func (a mockAddr) String() string { return string(a) }
+
+type mockTransport struct{ dialed, listened net.Addr }
+
+func (t *mockTransport) Listen(_ context.Context, a net.Addr) (Listener, error) {
+	t.listened = a
+	return nil, nil
+}
+
+func (t *mockTransport) Dial(_ context.Context, a net.Addr) (Conn, error) {
+	t.dialed = a
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	var r Registry
+	tp := new(mockTransport)
+	r.Register("MOCK", func(u *url.URL) (Transport, net.Addr, error) {
+		if u.Host == "" {
+			return nil, nil, errors.New("missing host")
+		}
+		return tp, mockAddr(u.Host), nil
+	})
+
+	t.Run("Resolve", func(t *testing.T) {
+		t.Run("Succeed", func(t *testing.T) {
+			res, a, err := r.Resolve("mock://foo")
+			assert.NoError(t, err)
+			assert.Equal(t, tp, res)
+			assert.Equal(t, mockAddr("foo"), a)
+		})
+
+		t.Run("Fail", func(t *testing.T) {
+			t.Run("UnknownScheme", func(t *testing.T) {
+				_, _, err := r.Resolve("bogus://foo")
+				assert.Error(t, err)
+			})
+
+			t.Run("MalformedURL", func(t *testing.T) {
+				_, _, err := r.Resolve("mock://%zz")
+				assert.Error(t, err)
+			})
+
+			t.Run("FactoryError", func(t *testing.T) {
+				_, _, err := r.Resolve("mock:///foo")
+				assert.Error(t, err)
+			})
+		})
+	})
+
+	t.Run("DialURL", func(t *testing.T) {
+		_, err := r.DialURL(context.Background(), "mock://dial")
+		assert.NoError(t, err)
+		assert.Equal(t, mockAddr("dial"), tp.dialed)
+	})
+
+	t.Run("DialAnyURL", func(t *testing.T) {
+		_, err := r.DialAnyURL(context.Background(), "mock://any")
+		assert.NoError(t, err)
+		assert.Equal(t, mockAddr("any"), tp.dialed)
+
+		_, err = r.DialAnyURL(context.Background(), "mock://any", "bogus://foo")
+		assert.Error(t, err)
+	})
+
+	t.Run("ListenURL", func(t *testing.T) {
+		_, err := r.ListenURL(context.Background(), "mock://listen")
+		assert.NoError(t, err)
+		assert.Equal(t, mockAddr("listen"), tp.listened)
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		other := new(mockTransport)
+		r.Register("mock", func(u *url.URL) (Transport, net.Addr, error) {
+			return other, mockAddr(u.Host), nil
+		})
+
+		res, _, err := r.Resolve("mock://foo")
+		assert.NoError(t, err)
+		assert.Equal(t, other, res)
+	})
+}
@@ -0,0 +1,153 @@
+package generic
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd
+const listenFdsStart = 3
+
+// inherited holds the activation sockets passed to the process, which are read
+// from the environment once.  Each may only be adopted once.
+var inherited struct {
+	sync.Mutex
+	parsed  bool
+	fds     []int
+	names   []string
+	adopted map[int]bool
+}
+
+// Activation is a NetListener that adopts sockets passed by systemd socket
+// activation, as described in sd_listen_fds(3).  Sockets are matched against
+// the requested address, or selected by name.  If none match, a new socket is
+// bound.
+type Activation struct {
+	// Name selects the socket by the name given in LISTEN_FDNAMES, which is set
+	// with FileDescriptorName= in the socket unit.  If empty, sockets are
+	// matched by network and address instead.  The unspecified IP address
+	// matches sockets bound to any address, on the same port.
+	Name string
+
+	// Fallback binds a new socket when no inherited socket matches.  Defaults
+	// to a net.ListenConfig.
+	Fallback NetListener
+}
+
+// Listen on an inherited socket, or on a new one
+func (a Activation) Listen(c context.Context, network, address string) (net.Listener, error) {
+	inherited.Lock()
+	defer inherited.Unlock()
+
+	if !inherited.parsed {
+		inherited.fds, inherited.names = listenFds()
+		inherited.parsed = true
+	}
+
+	fds, names := inherited.fds, inherited.names
+	for i, fd := range fds {
+		if inherited.adopted[fd] || (a.Name != "" && names[i] != a.Name) {
+			continue
+		}
+
+		l, err := fileListener(fd, names[i])
+		if err != nil {
+			continue // not a listening socket
+		}
+
+		if a.Name == "" && !matchAddr(l.Addr(), network, address) {
+			l.Close()
+			continue
+		}
+
+		if inherited.adopted == nil {
+			inherited.adopted = make(map[int]bool)
+		}
+		inherited.adopted[fd] = true
+		closeFd(fd) // the listener holds a duplicate
+
+		return l, nil
+	}
+
+	if a.Fallback == nil {
+		return new(net.ListenConfig).Listen(c, network, address)
+	}
+
+	return a.Fallback.Listen(c, network, address)
+}
+
+// listenFds returns the file descriptors passed to this process, along with
+// their names.  Unnamed descriptors are named "unknown", as in systemd.  As with
+// sd_listen_fds(3), the variables are removed from the environment, and the
+// descriptors are not inherited by child processes.
+func listenFds() (fds []int, names []string) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	n, nerr := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	fdnames := os.Getenv("LISTEN_FDNAMES")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if err != nil || pid != os.Getpid() || nerr != nil || n <= 0 {
+		return nil, nil
+	}
+
+	var given []string
+	if fdnames != "" {
+		given = strings.Split(fdnames, ":")
+	}
+
+	for i := 0; i < n; i++ {
+		closeOnExec(listenFdsStart + i)
+		fds = append(fds, listenFdsStart+i)
+		if i < len(given) {
+			names = append(names, given[i])
+		} else {
+			names = append(names, "unknown")
+		}
+	}
+
+	return fds, names
+}
+
+// fileListener creates a listener from a duplicate of fd, leaving fd open
+func fileListener(fd int, name string) (net.Listener, error) {
+	dup, err := dupFd(fd)
+	if err != nil {
+		return nil, errors.Wrap(err, "dup")
+	}
+
+	f := os.NewFile(uintptr(dup), name)
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+// matchAddr reports whether an inherited socket is bound to the address
+func matchAddr(bound net.Addr, network, address string) bool {
+	switch b := bound.(type) {
+	case *net.TCPAddr:
+		if !strings.HasPrefix(network, "tcp") {
+			return false
+		}
+
+		want, err := net.ResolveTCPAddr(network, address)
+		if err != nil || want.Port != b.Port {
+			return false
+		}
+
+		return want.IP == nil || want.IP.IsUnspecified() || want.IP.Equal(b.IP)
+
+	case *net.UnixAddr:
+		return network == b.Net && address == b.Name
+	}
+
+	return false
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package generic
+
+import "github.com/pkg/errors"
+
+func dupFd(int) (int, error) {
+	return -1, errors.New("socket activation is not supported on this platform")
+}
+
+func closeFd(int) {}
+
+func closeOnExec(int) {}
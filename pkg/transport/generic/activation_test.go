@@ -0,0 +1,168 @@
+//go:build linux
+// +build linux
+
+package generic
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+const activationEnv = "PIPEWERKS_ACTIVATION_HELPER"
+
+// TestActivationHelper is run as a child process by TestActivation, which
+// passes it a TCP socket named "web" and a unix socket named "ctl", as
+// systemd would.
+func TestActivationHelper(t *testing.T) {
+	addrs := os.Getenv(activationEnv)
+	if addrs == "" {
+		return
+	}
+	tcpAddr, unixAddr := strings.Split(addrs, "|")[0], strings.Split(addrs, "|")[1]
+
+	// systemd sets the PID of the process it starts
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	c := context.Background()
+
+	web, err := Activation{}.Listen(c, "tcp", tcpAddr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, tcpAddr, web.Addr().String())
+
+	// the environment is consumed, and the remaining socket is not inherited
+	// by child processes
+	for _, v := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		assert.Empty(t, os.Getenv(v), v)
+	}
+
+	flags, err := unix.FcntlInt(4, unix.F_GETFD, 0)
+	if assert.NoError(t, err) {
+		assert.NotZero(t, flags&unix.FD_CLOEXEC, "FD_CLOEXEC not set")
+	}
+
+	_, err = Activation{}.Listen(c, "tcp", tcpAddr)
+	assert.Error(t, err, "socket adopted twice")
+
+	ctl, err := Activation{Name: "ctl"}.Listen(c, "unix", "ignored")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, unixAddr, ctl.Addr().String())
+
+	fresh, err := Activation{}.Listen(c, "tcp", "127.0.0.1:0")
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, tcpAddr, fresh.Addr().String())
+		fresh.Close()
+	}
+
+	// show the parent that the sockets are live
+	for _, l := range []net.Listener{web, ctl} {
+		conn, err := l.Accept()
+		if assert.NoError(t, err) {
+			conn.Write([]byte("adopted"))
+			conn.Close()
+		}
+	}
+}
+
+func TestActivation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipewerks-activation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tl, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{Net: "unix", Name: filepath.Join(dir, "sock")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ul.SetUnlinkOnClose(false)
+
+	tf, err := tl.File()
+	assert.NoError(t, err)
+	uf, err := ul.File()
+	assert.NoError(t, err)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestActivationHelper$")
+	cmd.ExtraFiles = []*os.File{tf, uf} // descriptors 3 and 4
+	cmd.Env = append(os.Environ(),
+		"LISTEN_FDS=2",
+		"LISTEN_FDNAMES=web:ctl",
+		activationEnv+"="+tl.Addr().String()+"|"+ul.Addr().String())
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the child may accept connections
+	for _, c := range []interface{ Close() error }{tl, ul, tf, uf} {
+		c.Close()
+	}
+
+	for _, a := range []net.Addr{tl.Addr(), ul.Addr()} {
+		conn, err := net.Dial(a.Network(), a.String())
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		b, err := ioutil.ReadAll(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, "adopted", string(b), "%s was not adopted", a)
+		conn.Close()
+	}
+
+	b, _ := ioutil.ReadAll(out)
+	assert.NoError(t, cmd.Wait(), string(b))
+}
+
+func TestActivationFallback(t *testing.T) {
+	// descriptors meant for another process are ignored
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+
+	l, err := Activation{}.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, 0, l.Addr().(*net.TCPAddr).Port)
+		l.Close()
+	}
+}
+
+func TestMatchAddr(t *testing.T) {
+	bound := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+	assert.True(t, matchAddr(bound, "tcp", "127.0.0.1:8080"))
+	assert.True(t, matchAddr(bound, "tcp", ":8080"))
+	assert.True(t, matchAddr(bound, "tcp4", "0.0.0.0:8080"))
+	assert.False(t, matchAddr(bound, "tcp", "127.0.0.1:8081"))
+	assert.False(t, matchAddr(bound, "tcp", "10.0.0.1:8080"))
+	assert.False(t, matchAddr(bound, "unix", "/tmp/sock"))
+
+	sock := &net.UnixAddr{Net: "unix", Name: "/tmp/sock"}
+	assert.True(t, matchAddr(sock, "unix", "/tmp/sock"))
+	assert.False(t, matchAddr(sock, "unixpacket", "/tmp/sock"))
+	assert.False(t, matchAddr(sock, "unix", "/tmp/other"))
+}
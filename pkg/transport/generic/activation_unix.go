@@ -0,0 +1,12 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package generic
+
+import "syscall"
+
+func dupFd(fd int) (int, error) { return syscall.Dup(fd) }
+
+func closeFd(fd int) { syscall.Close(fd) }
+
+func closeOnExec(fd int) { syscall.CloseOnExec(fd) }
@@ -2,7 +2,11 @@ package generic
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/SentimensRG/ctx"
@@ -12,24 +16,114 @@ import (
 	"github.com/pkg/errors"
 )
 
+// errClosed is returned by Accept once the listener is closed
+var errClosed = errors.New("use of closed network connection")
+
+// listener upgrades incoming connections concurrently, so that a peer that
+// stalls during the handshake does not hold up the others.  Connections that
+// fail to upgrade are dropped.
 type listener struct {
 	serverMuxAdapter
 	net.Listener
+	sec SecurityAdapter
+
+	ch  chan accepted
+	die chan struct{}
+	o   sync.Once
 }
 
-func (l listener) Accept() (pipe.Conn, error) {
-	raw, err := l.Listener.Accept()
-	if err != nil {
-		return nil, errors.Wrap(err, "listener")
+type accepted struct {
+	conn pipe.Conn
+	err  error
+}
+
+func newListener(l net.Listener, mux serverMuxAdapter, sec SecurityAdapter) *listener {
+	ln := &listener{
+		serverMuxAdapter: mux,
+		Listener:         l,
+		sec:              sec,
+		ch:               make(chan accepted),
+		die:              make(chan struct{}),
 	}
+	go ln.serve()
+	return ln
+}
 
-	conn, err := l.AdaptServer(raw)
+func (l *listener) serve() {
+	for {
+		raw, err := l.Listener.Accept()
+		if err != nil {
+			// errors are reported to the caller, which decides whether to
+			// keep accepting
+			select {
+			case l.ch <- accepted{err: errors.Wrap(err, "listener")}:
+				continue
+			case <-l.die:
+				return
+			}
+		}
+
+		go l.handshake(raw)
+	}
+}
+
+func (l *listener) handshake(raw net.Conn) {
+	conn, err := l.upgrade(raw)
 	if err != nil {
 		raw.Close()
+		return
+	}
+
+	select {
+	case l.ch <- accepted{conn: conn}:
+	case <-l.die:
+		conn.Close()
+	}
+}
+
+func (l *listener) Accept() (pipe.Conn, error) {
+	select {
+	case a := <-l.ch:
+		return a.conn, a.err
+	case <-l.die:
+		return nil, errors.Wrap(errClosed, "listener")
+	}
+}
+
+func (l *listener) Close() error {
+	l.o.Do(func() { close(l.die) })
+	return l.Listener.Close()
+}
+
+func (l *listener) upgrade(raw net.Conn) (pipe.Conn, error) {
+	if l.sec == nil {
+		conn, err := l.AdaptServer(raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "mux")
+		}
+
+		return conn, nil
+	}
+
+	if err := setDeadline(raw, time.Now().Add(DefaultHandshakeTimeout)); err != nil {
+		return nil, errors.Wrap(err, "set deadline")
+	}
+
+	sc, err := l.sec.SecureServer(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "secure")
+	}
+
+	if err = setDeadline(raw, time.Time{}); err != nil {
+		return nil, errors.Wrap(err, "clear deadline")
+	}
+
+	conn, err := l.AdaptServer(sc)
+	if err != nil {
 		return nil, errors.Wrap(err, "mux")
 	}
 
-	return conn, nil
+	return sc.Wrap(conn), nil
 }
 
 type connection struct{ *yamux.Session }
@@ -44,7 +138,7 @@ func (c connection) OpenStream() (pipe.Stream, error) {
 		return nil, err
 	}
 
-	return mkStream(c.Context(), s), nil
+	return mkStream(c.Context(), yamuxStream{s}), nil
 }
 
 func (c connection) AcceptStream() (pipe.Stream, error) {
@@ -53,18 +147,38 @@ func (c connection) AcceptStream() (pipe.Stream, error) {
 		return nil, err
 	}
 
-	return mkStream(c.Context(), s), nil
+	return mkStream(c.Context(), yamuxStream{s}), nil
+}
+
+type yamuxStream struct{ *yamux.Stream }
+
+// CloseWrite sends a FIN to the remote end.  Yamux streams remain readable
+// until the remote end does the same.
+func (s yamuxStream) CloseWrite() error { return s.Stream.Close() }
+
+// muxStream is a stream produced by a MuxAdapter
+type muxStream interface {
+	net.Conn
+	StreamID() uint32
+	CloseWrite() error
 }
 
 type stream struct {
 	c      context.Context
 	cancel func()
-	s      *yamux.Stream
+	s      muxStream
+
+	rmu *sync.Mutex // held while reading from s
+	ro  *sync.Once
+	rq  chan struct{}
 }
 
-func mkStream(c context.Context, s *yamux.Stream) (strm stream) {
+func mkStream(c context.Context, s muxStream) (strm stream) {
 	strm.c, strm.cancel = context.WithCancel(c)
 	strm.s = s
+	strm.rmu = new(sync.Mutex)
+	strm.ro = new(sync.Once)
+	strm.rq = make(chan struct{})
 	return
 }
 
@@ -72,7 +186,18 @@ func (s stream) LocalAddr() net.Addr  { return s.s.LocalAddr() }
 func (s stream) RemoteAddr() net.Addr { return s.s.RemoteAddr() }
 
 func (s stream) Read(b []byte) (n int, err error) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+
+	if s.readClosed() {
+		return 0, io.ErrClosedPipe
+	}
+
 	if n, err = s.s.Read(b); err != nil {
+		if s.readClosed() {
+			return 0, io.ErrClosedPipe
+		}
+
 		err = s.chkErr(err)
 	}
 	return
@@ -117,9 +242,52 @@ func (s stream) chkErr(err error) error {
 	return err
 }
 
+func (s stream) readClosed() bool {
+	select {
+	case <-s.rq:
+		return true
+	default:
+		return false
+	}
+}
+
+// CloseRead is emulated locally, as multiplexers have no means of signalling it
+// to the remote end, which is not notified.  Pending calls to Read are unblocked.
+// Data received from the remote end is discarded until it closes its write-side,
+// so that it does not block once the receive window is full.
+func (s stream) CloseRead() error {
+	if s.stopReading() {
+		go s.discard()
+	}
+	return nil
+}
+
+// stopReading unblocks pending reads, and causes subsequent ones to fail.  It
+// reports whether this is the first call.
+func (s stream) stopReading() (first bool) {
+	s.ro.Do(func() {
+		close(s.rq)
+		s.s.SetReadDeadline(time.Now())
+		first = true
+	})
+	return
+}
+
+func (s stream) discard() {
+	// wait for pending reads to return
+	s.rmu.Lock()
+	s.s.SetReadDeadline(time.Time{})
+	s.rmu.Unlock()
+
+	io.Copy(ioutil.Discard, s.s)
+}
+
+func (s stream) CloseWrite() error { return s.s.CloseWrite() }
+
 func (s stream) Context() context.Context { return s.c }
 func (s stream) Close() error {
 	s.cancel()
+	s.stopReading()
 	return s.s.Close()
 }
 
@@ -128,15 +296,20 @@ type Transport struct {
 	MuxAdapter
 	NetListener
 	NetDialer
+
+	// SecurityAdapter is optional.  If set, connections are secured before
+	// being multiplexed.
+	SecurityAdapter
 }
 
 // Listen Generic
 func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
 	l, err := t.NetListener.Listen(c, a.Network(), a.String())
-	return listener{
-		serverMuxAdapter: t.MuxAdapter,
-		Listener:         l,
-	}, err
+	if err != nil {
+		return nil, err
+	}
+
+	return newListener(l, t.MuxAdapter, t.SecurityAdapter), nil
 }
 
 // Dial Generic
@@ -146,7 +319,93 @@ func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
 		return nil, errors.Wrap(err, "dial")
 	}
 
-	return t.AdaptClient(raw)
+	stop := watch(c, raw)
+	conn, err := t.upgrade(c, raw, a)
+	if werr := stop(); err == nil && werr != nil {
+		conn.Close()
+		err = errors.Wrap(werr, "dial")
+	}
+
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// watch interrupts I/O on the connection if the context expires before the
+// returned function is called.  The function reports the context's error in that
+// case, as the connection is no longer usable.
+func watch(c context.Context, conn net.Conn) (stop func() error) {
+	if c.Done() == nil {
+		return func() error { return nil }
+	}
+
+	done := make(chan struct{})
+	ch := make(chan error, 1)
+	go func() {
+		select {
+		case <-c.Done():
+			conn.SetDeadline(time.Unix(1, 0)) // in the past
+			ch <- c.Err()
+		case <-done:
+			ch <- nil
+		}
+	}()
+
+	return func() error {
+		close(done)
+		return <-ch
+	}
+}
+
+func (t Transport) upgrade(c context.Context, raw net.Conn, a net.Addr) (pipe.Conn, error) {
+	if t.SecurityAdapter == nil {
+		conn, err := t.AdaptClient(raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "mux")
+		}
+
+		return conn, nil
+	}
+
+	if d, ok := c.Deadline(); ok {
+		if err := setDeadline(raw, d); err != nil {
+			return nil, errors.Wrap(err, "set deadline")
+		}
+	}
+
+	sc, err := t.SecureClient(raw, a)
+	if err != nil {
+		return nil, errors.Wrap(err, "secure")
+	}
+
+	if err = setDeadline(raw, time.Time{}); err != nil {
+		return nil, errors.Wrap(err, "clear deadline")
+	}
+
+	conn, err := t.AdaptClient(sc)
+	if err != nil {
+		return nil, errors.Wrap(err, "mux")
+	}
+
+	return sc.Wrap(conn), nil
+}
+
+// setDeadline for a handshake.  Connections that do not support deadlines,
+// such as those over pipes, are handshaken without a timeout.
+func setDeadline(conn net.Conn, t time.Time) error {
+	err := conn.SetDeadline(t)
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+
+	if err == os.ErrNoDeadline {
+		return nil
+	}
+
+	return err
 }
 
 // MuxConfig is a MuxAdapter that uses github.com/hashicorp/yamux
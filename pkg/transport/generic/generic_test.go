@@ -1,57 +1,84 @@
 package generic
 
 import (
+	"io"
+	"io/ioutil"
 	"net"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/yamux"
 	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/sync/errgroup"
 )
 
+// mockListener returns a single connection, unless err is set
 type mockListener struct {
-	c   net.Conn
+	ch  chan net.Conn
 	err error
 }
 
-func newMockListener(err error) listener {
-	conn, _ := net.Pipe()
-	return listener{
-		serverMuxAdapter: MuxConfig{},
-		Listener: mockListener{
-			err: err,
-			c:   conn,
-		},
-	}
+func newMockListener(err error, mx serverMuxAdapter) (*listener, net.Conn) {
+	conn, remote := net.Pipe()
+	ch := make(chan net.Conn, 1)
+	ch <- conn
+
+	return newListener(mockListener{ch: ch, err: err}, mx, nil), remote
+}
+
+func (mockListener) Addr() net.Addr { return nil }
+
+func (l mockListener) Close() error {
+	close(l.ch)
+	return nil
 }
 
-func (mockListener) Addr() net.Addr              { return nil }
-func (mockListener) Close() error                { return nil }
-func (l mockListener) Accept() (net.Conn, error) { return l.c, l.err }
+func (l mockListener) Accept() (net.Conn, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	if c, ok := <-l.ch; ok {
+		return c, nil
+	}
+
+	return nil, errors.New("closed")
+}
 
 func TestListener(t *testing.T) {
 
 	t.Run("Accept", func(t *testing.T) {
 		t.Run("Succeed", func(t *testing.T) {
-			_, err := newMockListener(nil).Accept()
+			l, _ := newMockListener(nil, MuxConfig{})
+			defer l.Close()
+
+			_, err := l.Accept()
 			assert.NoError(t, err)
 		})
 
 		t.Run("Fail", func(t *testing.T) {
 			t.Run("ListenError", func(t *testing.T) {
-				_, err := newMockListener(errors.New("")).Accept()
+				l, _ := newMockListener(errors.New(""), MuxConfig{})
+				defer l.Close()
+
+				_, err := l.Accept()
 				assert.Error(t, err)
 			})
 
 			t.Run("MuxError", func(t *testing.T) {
-				l := newMockListener(nil)
 				var mx MuxConfig
 				mx.Config = new(yamux.Config)
-				l.serverMuxAdapter = mx
-				_, err := l.Accept()
+				l, remote := newMockListener(nil, mx)
+
+				// the connection is dropped, rather than returned
+				_, err := remote.Read(make([]byte, 1))
+				assert.Error(t, err, "connection not closed")
+
+				time.AfterFunc(10*time.Millisecond, func() { l.Close() })
+				_, err = l.Accept()
 				assert.Error(t, err)
 			})
 		})
@@ -142,7 +169,18 @@ func mkConn() (pipe.Conn, pipe.Conn, error) {
 func TestStream(t *testing.T) {
 	dc, lc, err := mkConn()
 	assert.NoError(t, err, "canary failed")
+	testStream(t, dc, lc)
+}
+
+func TestHalfClose(t *testing.T) {
+	dc, lc, err := mkConn()
+	assert.NoError(t, err, "canary failed")
+	transporttest.HalfClose(t, dc, lc)
+}
 
+// testStream checks the lifecycle of stream contexts.  It is shared by the tests
+// for each MuxAdapter.
+func testStream(t *testing.T, dc, lc pipe.Conn) {
 	var ds, ls pipe.Stream
 	var g errgroup.Group
 	g.Go(func() (err error) {
@@ -193,6 +231,10 @@ func TestStream(t *testing.T) {
 
 		t.Run("ListenStream", func(t *testing.T) {
 			_, err := ls.Read([]byte{}) // ensure context closure is triggered
+			if _, ok := lc.(smuxConn); ok {
+				// smux returns immediately from empty reads, even on closed streams
+				_, err = ls.Read(make([]byte, 1))
+			}
 			assert.Error(t, err)
 
 			assert.Error(t, ls.Context().Err())
@@ -204,3 +246,59 @@ func TestStream(t *testing.T) {
 		})
 	})
 }
+
+func BenchmarkMuxAdapter(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		mx   MuxAdapter
+	}{
+		{"yamux", MuxConfig{}},
+		{"smux", SmuxConfig{}},
+		{"mplex", MplexConfig{}},
+	} {
+		b.Run(bc.name, func(b *testing.B) { benchmarkMux(b, bc.mx) })
+	}
+}
+
+func benchmarkMux(b *testing.B, mx MuxAdapter) {
+	ds, ls := net.Pipe()
+
+	var dc, lc pipe.Conn
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		dc, err = mx.AdaptClient(ds)
+		return
+	})
+	g.Go(func() (err error) {
+		lc, err = mx.AdaptServer(ls)
+		return
+	})
+	if err := g.Wait(); err != nil {
+		b.Fatal(err)
+	}
+	defer dc.Close()
+	defer lc.Close()
+
+	go func() {
+		s, err := lc.AcceptStream()
+		if err != nil {
+			return
+		}
+		io.Copy(ioutil.Discard, s)
+	}()
+
+	s, err := dc.OpenStream()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	snd := make([]byte, 4096)
+	b.SetBytes(int64(len(snd)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Write(snd); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
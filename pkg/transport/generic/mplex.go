@@ -0,0 +1,50 @@
+package generic
+
+import (
+	"context"
+	"net"
+
+	"github.com/SentimensRG/ctx"
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/mplex"
+	"github.com/pkg/errors"
+)
+
+type mplexConn struct{ *mplex.Session }
+
+func (c mplexConn) Context() context.Context {
+	return ctx.AsContext(ctx.C(c.CloseChan()))
+}
+
+func (c mplexConn) OpenStream() (pipe.Stream, error) {
+	s, err := c.Session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+
+	return mkStream(c.Context(), s), nil
+}
+
+func (c mplexConn) AcceptStream() (pipe.Stream, error) {
+	s, err := c.Session.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+
+	return mkStream(c.Context(), s), nil
+}
+
+// MplexConfig is a MuxAdapter that uses the mplex protocol
+type MplexConfig struct{ *mplex.Config }
+
+// AdaptServer is called by the listener
+func (c MplexConfig) AdaptServer(conn net.Conn) (pipe.Conn, error) {
+	sess, err := mplex.Server(conn, c.Config)
+	return mplexConn{Session: sess}, errors.Wrap(err, "mplex")
+}
+
+// AdaptClient is called by the dialer
+func (c MplexConfig) AdaptClient(conn net.Conn) (pipe.Conn, error) {
+	sess, err := mplex.Client(conn, c.Config)
+	return mplexConn{Session: sess}, errors.Wrap(err, "mplex")
+}
@@ -0,0 +1,105 @@
+package generic
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/lthibault/pipewerks/pkg/mplex"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMplexConfig(t *testing.T) {
+	var mx MplexConfig
+	dconn, lconn := net.Pipe()
+
+	t.Run("ValidConfig", func(t *testing.T) {
+		t.Run("AdaptClient", func(t *testing.T) {
+			_, err := mx.AdaptClient(dconn)
+			assert.NoError(t, err)
+		})
+
+		t.Run("AdaptServer", func(t *testing.T) {
+			_, err := mx.AdaptServer(lconn)
+			assert.NoError(t, err)
+		})
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		mx.Config = new(mplex.Config)
+		assert.Error( // sanity check
+			t,
+			mplex.VerifyConfig(mx.Config),
+			"MPLEX config is valid. Subsequent tests will FAIL.",
+		)
+
+		t.Run("AdaptClient", func(t *testing.T) {
+			_, err := mx.AdaptClient(dconn)
+			assert.Error(t, err)
+		})
+
+		t.Run("AdaptServer", func(t *testing.T) {
+			_, err := mx.AdaptServer(lconn)
+			assert.Error(t, err)
+		})
+	})
+}
+
+func TestMplexConnection(t *testing.T) {
+	yc, c := net.Pipe()
+
+	dsess, err := mplex.Client(c, nil)
+	assert.NoError(t, err)
+
+	lsess, err := mplex.Server(yc, nil)
+	assert.NoError(t, err)
+
+	conn := mplexConn{lsess}
+	assert.NoError(t, conn.Context().Err())
+
+	t.Run("Close", func(t *testing.T) {
+		assert.NoError(t, dsess.Close())
+		time.Sleep(time.Millisecond)
+
+		assert.Error(t, conn.Context().Err())
+		assert.True(t, func() bool {
+			select {
+			case <-conn.Context().Done():
+				return true
+			default:
+				return false
+			}
+		}())
+	})
+}
+
+func mkMplexConn() (pipe.Conn, pipe.Conn, error) {
+	ds, ls := net.Pipe()
+
+	dsess, err := mplex.Client(ds, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "client conn")
+	}
+
+	lsess, err := mplex.Server(ls, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "server conn")
+	}
+
+	return mplexConn{dsess}, mplexConn{lsess}, nil
+}
+
+func TestMplexStream(t *testing.T) {
+	dc, lc, err := mkMplexConn()
+	assert.NoError(t, err, "canary failed")
+	testStream(t, dc, lc)
+}
+
+func TestMplexHalfClose(t *testing.T) {
+	dc, lc, err := mkMplexConn()
+	assert.NoError(t, err, "canary failed")
+	transporttest.HalfClose(t, dc, lc)
+}
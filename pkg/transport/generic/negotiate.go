@@ -0,0 +1,247 @@
+package generic
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+)
+
+// Protocol IDs for the multiplexers provided by this package
+const (
+	YamuxID = "/yamux/1.0.0"
+	SmuxID  = "/smux/1.0.0"
+	MplexID = "/mplex/6.7.0"
+)
+
+const (
+	multistreamID = "/multistream/1.0.0"
+	msgNA         = "na"
+	maxMsgSize    = 1024
+)
+
+// DefaultNegotiationTimeout bounds the time spent negotiating a multiplexer
+var DefaultNegotiationTimeout = time.Second * 10
+
+// MuxProtocol associates a MuxAdapter with a protocol ID
+type MuxProtocol struct {
+	ID string
+	MuxAdapter
+}
+
+// Negotiator is a MuxAdapter that agrees upon a multiplexer with the remote peer
+// before adapting the connection.  The dialer proposes protocols in order of
+// preference, and the listener accepts the first one it supports.
+//
+// The handshake follows multistream-select 1.0.0, so a Negotiator can
+// interoperate with libp2p peers.
+type Negotiator struct {
+	Protocols []MuxProtocol
+
+	// Timeout for the handshake.  Zero means DefaultNegotiationTimeout, and a
+	// negative value means no timeout.
+	Timeout time.Duration
+}
+
+// AdaptServer is called by the listener
+func (n Negotiator) AdaptServer(conn net.Conn) (pipe.Conn, error) {
+	if err := n.setDeadline(conn); err != nil {
+		return nil, err
+	}
+
+	p, err := n.handleProposals(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "negotiate")
+	}
+
+	if err = setDeadline(conn, time.Time{}); err != nil {
+		return nil, errors.Wrap(err, "negotiate")
+	}
+
+	return p.AdaptServer(conn)
+}
+
+// AdaptClient is called by the dialer
+func (n Negotiator) AdaptClient(conn net.Conn) (pipe.Conn, error) {
+	if err := n.setDeadline(conn); err != nil {
+		return nil, err
+	}
+
+	p, err := n.propose(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "negotiate")
+	}
+
+	if err = setDeadline(conn, time.Time{}); err != nil {
+		return nil, errors.Wrap(err, "negotiate")
+	}
+
+	return p.AdaptClient(conn)
+}
+
+func (n Negotiator) setDeadline(conn net.Conn) error {
+	timeout := n.Timeout
+	switch {
+	case timeout < 0:
+		return nil
+	case timeout == 0:
+		timeout = DefaultNegotiationTimeout
+	}
+
+	return errors.Wrap(setDeadline(conn, time.Now().Add(timeout)), "negotiate")
+}
+
+func (n Negotiator) lookup(id string) (MuxProtocol, bool) {
+	for _, p := range n.Protocols {
+		if p.ID == id {
+			return p, true
+		}
+	}
+
+	return MuxProtocol{}, false
+}
+
+func (n Negotiator) ids() []string {
+	ids := make([]string, len(n.Protocols))
+	for i, p := range n.Protocols {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func (n Negotiator) propose(conn net.Conn) (MuxProtocol, error) {
+	if len(n.Protocols) == 0 {
+		return MuxProtocol{}, errors.New("no protocols to propose")
+	}
+
+	// Send the header along with the first proposal to save a round-trip.
+	if err := writeMsg(conn, multistreamID, n.Protocols[0].ID); err != nil {
+		return MuxProtocol{}, err
+	}
+
+	if err := readHeader(conn); err != nil {
+		return MuxProtocol{}, err
+	}
+
+	for i, p := range n.Protocols {
+		if i > 0 {
+			if err := writeMsg(conn, p.ID); err != nil {
+				return MuxProtocol{}, err
+			}
+		}
+
+		resp, err := readMsg(conn)
+		if err != nil {
+			return MuxProtocol{}, err
+		}
+
+		switch resp {
+		case p.ID:
+			return p, nil
+		case msgNA:
+		default:
+			return MuxProtocol{}, errors.Errorf("unexpected response '%s' to proposal '%s'", resp, p.ID)
+		}
+	}
+
+	return MuxProtocol{}, errors.Errorf("remote peer supports none of %s",
+		strings.Join(n.ids(), ", "))
+}
+
+func (n Negotiator) handleProposals(conn net.Conn) (MuxProtocol, error) {
+	if err := readHeader(conn); err != nil {
+		return MuxProtocol{}, err
+	}
+
+	// The header is sent along with the response to the first proposal.  This
+	// avoids having both peers write at once, which would deadlock over
+	// unbuffered connections such as net.Pipe.
+	reply := []string{multistreamID}
+
+	for {
+		id, err := readMsg(conn)
+		if err == io.EOF {
+			return MuxProtocol{}, errors.Errorf("remote peer supports none of %s",
+				strings.Join(n.ids(), ", "))
+		} else if err != nil {
+			return MuxProtocol{}, err
+		}
+
+		p, ok := n.lookup(id)
+		if !ok {
+			if err = writeMsg(conn, append(reply, msgNA)...); err != nil {
+				return MuxProtocol{}, err
+			}
+
+			reply = nil
+			continue
+		}
+
+		return p, writeMsg(conn, append(reply, p.ID)...)
+	}
+}
+
+func readHeader(r io.Reader) error {
+	h, err := readMsg(r)
+	if err != nil {
+		return err
+	}
+
+	if h != multistreamID {
+		return errors.Errorf("expected header '%s', got '%s'", multistreamID, h)
+	}
+
+	return nil
+}
+
+// writeMsg writes each message as a uvarint length prefix followed by the
+// newline-terminated message.  All messages are sent in a single write.
+func writeMsg(w io.Writer, msgs ...string) error {
+	var buf []byte
+	for _, msg := range msgs {
+		var hdr [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(hdr[:], uint64(len(msg)+1))
+		buf = append(buf, hdr[:n]...)
+		buf = append(buf, msg...)
+		buf = append(buf, '\n')
+	}
+
+	_, err := w.Write(buf)
+	return errors.Wrap(err, "write")
+}
+
+// readMsg reads a single message.  It does not buffer, so that no bytes are
+// consumed beyond the end of the negotiation.
+func readMsg(r io.Reader) (string, error) {
+	size, err := binary.ReadUvarint(byteReader{r})
+	if err != nil {
+		return "", err
+	}
+
+	if size == 0 || size > maxMsgSize {
+		return "", errors.Errorf("invalid message size %d", size)
+	}
+
+	b := make([]byte, size)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return "", errors.Wrap(err, "read")
+	}
+
+	if b[size-1] != '\n' {
+		return "", errors.New("message not terminated by newline")
+	}
+
+	return string(b[:size-1]), nil
+}
+
+type byteReader struct{ io.Reader }
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
@@ -0,0 +1,176 @@
+package generic
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	yamuxProto = MuxProtocol{ID: YamuxID, MuxAdapter: MuxConfig{}}
+	smuxProto  = MuxProtocol{ID: SmuxID, MuxAdapter: SmuxConfig{}}
+	mplexProto = MuxProtocol{ID: MplexID, MuxAdapter: MplexConfig{}}
+)
+
+func negotiate(dialer, listener MuxAdapter) (dc, lc pipe.Conn, derr, lerr error) {
+	ds, ls := net.Pipe()
+
+	var g errgroup.Group
+	g.Go(func() error {
+		if dc, derr = dialer.AdaptClient(ds); derr != nil {
+			ds.Close()
+		}
+		return nil
+	})
+	g.Go(func() error {
+		if lc, lerr = listener.AdaptServer(ls); lerr != nil {
+			ls.Close()
+		}
+		return nil
+	})
+	g.Wait()
+
+	return
+}
+
+func TestNegotiator(t *testing.T) {
+	listener := Negotiator{Protocols: []MuxProtocol{yamuxProto, smuxProto}}
+
+	t.Run("FirstChoice", func(t *testing.T) {
+		dialer := Negotiator{Protocols: []MuxProtocol{yamuxProto, smuxProto}}
+
+		dc, lc, derr, lerr := negotiate(dialer, listener)
+		assert.NoError(t, derr)
+		assert.NoError(t, lerr)
+		assert.IsType(t, connection{}, dc)
+		assert.IsType(t, connection{}, lc)
+
+		testStream(t, dc, lc)
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		dialer := Negotiator{Protocols: []MuxProtocol{mplexProto, smuxProto}}
+
+		dc, lc, derr, lerr := negotiate(dialer, listener)
+		assert.NoError(t, derr)
+		assert.NoError(t, lerr)
+		assert.IsType(t, smuxConn{}, dc)
+		assert.IsType(t, smuxConn{}, lc)
+
+		testStream(t, dc, lc)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		dialer := Negotiator{Protocols: []MuxProtocol{mplexProto}}
+
+		_, _, derr, lerr := negotiate(dialer, listener)
+		assert.Error(t, derr)
+		assert.Contains(t, derr.Error(), "supports none of "+MplexID)
+		assert.Error(t, lerr)
+	})
+
+	t.Run("NotNegotiating", func(t *testing.T) {
+		ds, ls := net.Pipe()
+		defer ds.Close()
+
+		// yamux ping frame
+		go ds.Write([]byte{0, 2, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0})
+
+		_, err := listener.AdaptServer(ls)
+		assert.Error(t, err)
+	})
+
+	t.Run("NoProtocols", func(t *testing.T) {
+		_, _, derr, lerr := negotiate(Negotiator{}, listener)
+		assert.Error(t, derr)
+		assert.Error(t, lerr)
+	})
+}
+
+type deadlineConn struct {
+	net.Conn
+	d time.Time
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	c.d = t
+	return nil
+}
+
+func TestNegotiatorTimeout(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		conn := new(deadlineConn)
+		assert.NoError(t, Negotiator{}.setDeadline(conn))
+		assert.WithinDuration(t, time.Now().Add(DefaultNegotiationTimeout), conn.d, time.Second)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		conn := new(deadlineConn)
+		assert.NoError(t, Negotiator{Timeout: -1}.setDeadline(conn))
+		assert.True(t, conn.d.IsZero())
+	})
+
+	t.Run("DialContext", func(t *testing.T) {
+		// the listener never negotiates
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer l.Close()
+
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		dt := mkTCPTransport(OptMuxAdapter(Negotiator{
+			Protocols: []MuxProtocol{yamuxProto},
+			Timeout:   -1,
+		}))
+
+		c, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		ch := make(chan error, 1)
+		go func() {
+			_, err := dt.Dial(c, l.Addr())
+			ch <- err
+		}()
+
+		select {
+		case err := <-ch:
+			assert.Error(t, err)
+		case <-time.After(time.Second):
+			t.Error("dial ignored the context deadline")
+		}
+	})
+}
+
+func TestMessage(t *testing.T) {
+	r, w := net.Pipe()
+
+	go func() {
+		writeMsg(w, multistreamID, YamuxID)
+		w.Write([]byte{0})
+		w.Close()
+	}()
+
+	assert.NoError(t, readHeader(r))
+
+	msg, err := readMsg(r)
+	assert.NoError(t, err)
+	assert.Equal(t, YamuxID, msg)
+
+	_, err = readMsg(r)
+	assert.Error(t, err, "zero-length message accepted")
+}
@@ -0,0 +1,218 @@
+package generic
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/flynn/noise"
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+)
+
+const (
+	noiseMaxMsgSize    = 65535
+	noiseMaxPlaintext  = noiseMaxMsgSize - 16 // Poly1305 tag
+	noiseLengthPrefix  = 2
+	noisePrologue      = "pipewerks-noise"
+	noiseHandshakeMsgs = 3
+)
+
+var noiseSuite = noise.NewCipherSuite(noise.DH25519, noise.CipherChaChaPoly, noise.HashSHA256)
+
+// NoiseConn is a pipe.Conn that is secured by the Noise protocol.  Peers are
+// identified by their static public key.
+type NoiseConn interface {
+	pipe.IdentifiedConn
+
+	// RemoteStatic returns the static public key of the remote peer
+	RemoteStatic() []byte
+}
+
+type noiseConn struct {
+	pipe.Conn
+	local, remote []byte
+}
+
+func (c noiseConn) RemoteStatic() []byte    { return c.remote }
+func (c noiseConn) LocalPeer() pipe.PeerID  { return c.local }
+func (c noiseConn) RemotePeer() pipe.PeerID { return c.remote }
+
+// NewNoiseKeypair generates a static Curve25519 keypair for use with NoiseConfig
+func NewNoiseKeypair() (noise.DHKey, error) {
+	return noise.DH25519.GenerateKeypair(rand.Reader)
+}
+
+// NoiseConfig is a SecurityAdapter that performs a Noise XX handshake
+// (Curve25519, ChaCha20-Poly1305, SHA256), mutually authenticating peers by
+// their static keys.
+type NoiseConfig struct {
+	// StaticKeypair identifies the local peer
+	StaticKeypair noise.DHKey
+
+	// Authorize is called with the static public key of the remote peer once
+	// the handshake completes.  Returning an error aborts the connection.  If
+	// nil, all peers are accepted.
+	Authorize func(remoteStatic []byte) error
+}
+
+// SecureServer is called by the listener
+func (c NoiseConfig) SecureServer(conn net.Conn) (SecureConn, error) {
+	return c.handshake(conn, false)
+}
+
+// SecureClient is called by the dialer
+func (c NoiseConfig) SecureClient(conn net.Conn, _ net.Addr) (SecureConn, error) {
+	return c.handshake(conn, true)
+}
+
+func (c NoiseConfig) handshake(conn net.Conn, initiator bool) (SecureConn, error) {
+	hs, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:   noiseSuite,
+		Random:        rand.Reader,
+		Pattern:       noise.HandshakeXX,
+		Initiator:     initiator,
+		Prologue:      []byte(noisePrologue),
+		StaticKeypair: c.StaticKeypair,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var cs1, cs2 *noise.CipherState
+
+	// The initiator writes even-numbered messages, and the responder
+	// odd-numbered ones.
+	for i := 0; i < noiseHandshakeMsgs; i++ {
+		if (i%2 == 0) == initiator {
+			var msg []byte
+			if msg, cs1, cs2, err = hs.WriteMessage(nil, nil); err != nil {
+				return nil, errors.Wrap(err, "write handshake")
+			}
+
+			if err = writeNoiseMsg(conn, msg); err != nil {
+				return nil, err
+			}
+		} else {
+			msg, err := readNoiseMsg(conn)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, cs1, cs2, err = hs.ReadMessage(nil, msg); err != nil {
+				return nil, errors.Wrap(err, "read handshake")
+			}
+		}
+	}
+
+	if c.Authorize != nil {
+		if err = c.Authorize(hs.PeerStatic()); err != nil {
+			return nil, errors.Wrap(err, "unauthorized")
+		}
+	}
+
+	sc := &noiseSecureConn{
+		Conn:   conn,
+		local:  c.StaticKeypair.Public,
+		remote: hs.PeerStatic(),
+	}
+	if initiator {
+		sc.enc, sc.dec = cs1, cs2
+	} else {
+		sc.enc, sc.dec = cs2, cs1
+	}
+
+	return sc, nil
+}
+
+// noiseSecureConn encrypts data in length-prefixed Noise transport messages
+type noiseSecureConn struct {
+	net.Conn
+	local, remote []byte
+
+	rmu sync.Mutex
+	dec *noise.CipherState
+	buf []byte
+
+	wmu sync.Mutex
+	enc *noise.CipherState
+}
+
+func (c *noiseSecureConn) Wrap(conn pipe.Conn) pipe.Conn {
+	return noiseConn{Conn: conn, local: c.local, remote: c.remote}
+}
+
+func (c *noiseSecureConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for len(c.buf) == 0 {
+		msg, err := readNoiseMsg(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+
+		if c.buf, err = c.dec.Decrypt(msg[:0], nil, msg); err != nil {
+			return 0, errors.Wrap(err, "decrypt")
+		}
+	}
+
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *noiseSecureConn) Write(b []byte) (n int, err error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > noiseMaxPlaintext {
+			chunk = chunk[:noiseMaxPlaintext]
+		}
+
+		msg, err := c.enc.Encrypt(make([]byte, noiseLengthPrefix, noiseLengthPrefix+len(chunk)+16), nil, chunk)
+		if err != nil {
+			return n, errors.Wrap(err, "encrypt")
+		}
+
+		binary.BigEndian.PutUint16(msg, uint16(len(msg)-noiseLengthPrefix))
+		if _, err = c.Conn.Write(msg); err != nil {
+			return n, err
+		}
+
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+
+	return
+}
+
+func writeNoiseMsg(w io.Writer, msg []byte) error {
+	if len(msg) > noiseMaxMsgSize {
+		return errors.New("noise message too large")
+	}
+
+	buf := make([]byte, noiseLengthPrefix, noiseLengthPrefix+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+
+	_, err := w.Write(append(buf, msg...))
+	return err
+}
+
+func readNoiseMsg(r io.Reader) ([]byte, error) {
+	var hdr [noiseLengthPrefix]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,110 @@
+package generic
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestNoise(t *testing.T) {
+	lkey, err := NewNoiseKeypair()
+	assert.NoError(t, err)
+
+	dkey, err := NewNoiseKeypair()
+	assert.NoError(t, err)
+
+	lt := mkTCPTransport(OptNoise(NoiseConfig{
+		StaticKeypair: lkey,
+		Authorize: func(remote []byte) error {
+			if !bytes.Equal(remote, dkey.Public) {
+				return errors.New("unknown peer")
+			}
+			return nil
+		},
+	}))
+
+	l, err := lt.Listen(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	t.Run("Succeed", func(t *testing.T) {
+		dt := mkTCPTransport(OptNoise(NoiseConfig{StaticKeypair: dkey}))
+
+		var dc, lc pipe.Conn
+		var g errgroup.Group
+		g.Go(func() (err error) {
+			lc, err = l.Accept()
+			return
+		})
+		g.Go(func() (err error) {
+			dc, err = dt.Dial(context.Background(), l.Addr())
+			return
+		})
+		assert.NoError(t, g.Wait())
+
+		assert.Implements(t, (*NoiseConn)(nil), dc)
+		assert.Equal(t, lkey.Public, dc.(NoiseConn).RemoteStatic())
+
+		assert.Implements(t, (*NoiseConn)(nil), lc)
+		assert.Equal(t, dkey.Public, lc.(NoiseConn).RemoteStatic())
+
+		assert.Equal(t, pipe.PeerID(dkey.Public), dc.(pipe.IdentifiedConn).LocalPeer())
+		assert.Equal(t, pipe.PeerID(lkey.Public), dc.(pipe.IdentifiedConn).RemotePeer())
+
+		t.Run("LargeWrite", func(t *testing.T) {
+			msg := make([]byte, noiseMaxMsgSize*3) // spans several noise messages
+			for i := range msg {
+				msg[i] = byte(i)
+			}
+
+			var ds, ls pipe.Stream
+			g.Go(func() (err error) {
+				ds, err = dc.OpenStream()
+				return
+			})
+			g.Go(func() (err error) {
+				ls, err = lc.AcceptStream()
+				return
+			})
+			assert.NoError(t, g.Wait())
+
+			g.Go(func() error {
+				_, err := ds.Write(msg)
+				return err
+			})
+
+			b := make([]byte, len(msg))
+			_, err := io.ReadFull(ls, b)
+			assert.NoError(t, err)
+			assert.Equal(t, msg, b)
+			assert.NoError(t, g.Wait())
+		})
+
+		testStream(t, dc, lc)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		other, err := NewNoiseKeypair()
+		assert.NoError(t, err)
+
+		dt := mkTCPTransport(OptNoise(NoiseConfig{StaticKeypair: other}))
+
+		accepted := acceptAsync(l)
+
+		dt.Dial(context.Background(), l.Addr())
+
+		select {
+		case <-accepted:
+			t.Error("unauthorized peer was accepted")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
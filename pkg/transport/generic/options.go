@@ -2,6 +2,7 @@ package generic
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 
 	pipe "github.com/lthibault/pipewerks/pkg"
@@ -17,6 +18,12 @@ type NetDialer interface {
 	DialContext(c context.Context, network, address string) (net.Conn, error)
 }
 
+// PacketListener can produce a standard library PacketConn.  It is satisfied by
+// net.ListenConfig.
+type PacketListener interface {
+	ListenPacket(c context.Context, network, address string) (net.PacketConn, error)
+}
+
 type serverMuxAdapter interface {
 	AdaptServer(net.Conn) (pipe.Conn, error)
 }
@@ -56,3 +63,35 @@ func OptMuxAdapter(x MuxAdapter) Option {
 		return
 	}
 }
+
+// OptNegotiate negotiates a multiplexer with the remote peer before adapting
+// each connection.  Protocols are listed in order of preference.
+func OptNegotiate(ps ...MuxProtocol) Option {
+	return OptMuxAdapter(Negotiator{
+		Protocols: ps,
+		Timeout:   DefaultNegotiationTimeout,
+	})
+}
+
+// OptSecurity sets the security adapter.  A nil adapter disables security.
+func OptSecurity(x SecurityAdapter) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptSecurity(t.SecurityAdapter)
+		t.SecurityAdapter = x
+		return
+	}
+}
+
+// OptTLS secures connections with TLS before they are multiplexed.  A nil
+// config disables security.
+func OptTLS(c *tls.Config) Option {
+	if c == nil {
+		return OptSecurity(nil)
+	}
+
+	return OptSecurity(TLSConfig{Config: c})
+}
+
+// OptNoise secures connections with the Noise protocol before they are
+// multiplexed
+func OptNoise(c NoiseConfig) Option { return OptSecurity(c) }
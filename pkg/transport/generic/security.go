@@ -0,0 +1,29 @@
+package generic
+
+import (
+	"net"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+)
+
+// DefaultHandshakeTimeout bounds the time spent securing incoming connections
+var DefaultHandshakeTimeout = time.Second * 10
+
+// SecurityAdapter secures a raw connection before it is multiplexed.  Deadlines
+// on the raw connection are managed by the transport for the duration of the
+// handshake.
+type SecurityAdapter interface {
+	SecureServer(net.Conn) (SecureConn, error)
+	SecureClient(net.Conn, net.Addr) (SecureConn, error)
+}
+
+// SecureConn is a net.Conn that was secured by a SecurityAdapter
+type SecureConn interface {
+	net.Conn
+
+	// Wrap the pipe.Conn that was multiplexed over the SecureConn, exposing the
+	// security properties of the connection.  The result should implement
+	// pipe.IdentifiedConn.
+	Wrap(pipe.Conn) pipe.Conn
+}
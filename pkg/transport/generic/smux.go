@@ -0,0 +1,90 @@
+package generic
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/SentimensRG/ctx"
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+	"github.com/xtaci/smux"
+)
+
+// readErrConn signals read errors on the underlying net.Conn.  Smux does not
+// close the session when the connection fails, so this is done on its behalf.
+type readErrConn struct {
+	net.Conn
+	o  *sync.Once
+	cq chan struct{}
+}
+
+func mkReadErrConn(conn net.Conn) readErrConn {
+	return readErrConn{Conn: conn, o: new(sync.Once), cq: make(chan struct{})}
+}
+
+func (c readErrConn) Read(b []byte) (n int, err error) {
+	if n, err = c.Conn.Read(b); err != nil {
+		c.o.Do(func() { close(c.cq) })
+	}
+	return
+}
+
+type smuxConn struct{ *smux.Session }
+
+func mkSmuxConn(sess *smux.Session, conn readErrConn) smuxConn {
+	if sess != nil {
+		go func() {
+			select {
+			case <-conn.cq:
+				sess.Close()
+			case <-sess.CloseChan():
+			}
+		}()
+	}
+
+	return smuxConn{Session: sess}
+}
+
+func (c smuxConn) Context() context.Context {
+	return ctx.AsContext(ctx.C(c.CloseChan()))
+}
+
+func (c smuxConn) OpenStream() (pipe.Stream, error) {
+	s, err := c.Session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+
+	return mkStream(c.Context(), smuxStream{s}), nil
+}
+
+func (c smuxConn) AcceptStream() (pipe.Stream, error) {
+	s, err := c.Session.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+
+	return mkStream(c.Context(), smuxStream{s}), nil
+}
+
+type smuxStream struct{ *smux.Stream }
+
+func (s smuxStream) StreamID() uint32 { return s.ID() }
+
+// SmuxConfig is a MuxAdapter that uses github.com/xtaci/smux
+type SmuxConfig struct{ *smux.Config }
+
+// AdaptServer is called by the listener
+func (c SmuxConfig) AdaptServer(conn net.Conn) (pipe.Conn, error) {
+	rc := mkReadErrConn(conn)
+	sess, err := smux.Server(rc, c.Config)
+	return mkSmuxConn(sess, rc), errors.Wrap(err, "smux")
+}
+
+// AdaptClient is called by the dialer
+func (c SmuxConfig) AdaptClient(conn net.Conn) (pipe.Conn, error) {
+	rc := mkReadErrConn(conn)
+	sess, err := smux.Client(rc, c.Config)
+	return mkSmuxConn(sess, rc), errors.Wrap(err, "smux")
+}
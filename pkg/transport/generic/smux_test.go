@@ -0,0 +1,101 @@
+package generic
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/xtaci/smux"
+)
+
+func TestSmuxConfig(t *testing.T) {
+	var mx SmuxConfig
+	dconn, lconn := net.Pipe()
+
+	t.Run("ValidConfig", func(t *testing.T) {
+		t.Run("AdaptClient", func(t *testing.T) {
+			_, err := mx.AdaptClient(dconn)
+			assert.NoError(t, err)
+		})
+
+		t.Run("AdaptServer", func(t *testing.T) {
+			_, err := mx.AdaptServer(lconn)
+			assert.NoError(t, err)
+		})
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		mx.Config = new(smux.Config)
+		assert.Error( // sanity check
+			t,
+			smux.VerifyConfig(mx.Config),
+			"SMUX config is valid. Subsequent tests will FAIL.",
+		)
+
+		t.Run("AdaptClient", func(t *testing.T) {
+			_, err := mx.AdaptClient(dconn)
+			assert.Error(t, err)
+		})
+
+		t.Run("AdaptServer", func(t *testing.T) {
+			_, err := mx.AdaptServer(lconn)
+			assert.Error(t, err)
+		})
+	})
+}
+
+func TestSmuxConnection(t *testing.T) {
+	dc, lc, err := mkSmuxPair()
+	assert.NoError(t, err)
+	assert.NoError(t, lc.Context().Err())
+
+	t.Run("Close", func(t *testing.T) {
+		assert.NoError(t, dc.Close())
+		time.Sleep(time.Millisecond)
+
+		assert.Error(t, lc.Context().Err())
+		assert.True(t, func() bool {
+			select {
+			case <-lc.Context().Done():
+				return true
+			default:
+				return false
+			}
+		}())
+	})
+}
+
+// mkSmuxPair goes through SmuxConfig, which closes the session when the
+// underlying connection fails.
+func mkSmuxPair() (pipe.Conn, pipe.Conn, error) {
+	var mx SmuxConfig
+	ds, ls := net.Pipe()
+
+	dc, err := mx.AdaptClient(ds)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "client conn")
+	}
+
+	lc, err := mx.AdaptServer(ls)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "server conn")
+	}
+
+	return dc, lc, nil
+}
+
+func TestSmuxStream(t *testing.T) {
+	dc, lc, err := mkSmuxPair()
+	assert.NoError(t, err, "canary failed")
+	testStream(t, dc, lc)
+}
+
+func TestSmuxHalfClose(t *testing.T) {
+	dc, lc, err := mkSmuxPair()
+	assert.NoError(t, err, "canary failed")
+	transporttest.HalfClose(t, dc, lc)
+}
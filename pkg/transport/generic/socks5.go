@@ -0,0 +1,68 @@
+package generic
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// HostAddr is a network address whose host has not been resolved, so that it may
+// be resolved by the dialer, e.g. by a SOCKS5 proxy.
+type HostAddr struct {
+	Net  string
+	Host string // host:port
+}
+
+// Network returns the address's network name, e.g. "tcp"
+func (a HostAddr) Network() string { return a.Net }
+
+func (a HostAddr) String() string { return a.Host }
+
+// SOCKS5 is a NetDialer that connects through a SOCKS5 proxy, as described in
+// RFC 1928.  Hostnames are resolved by the proxy, provided that they reach the
+// dialer unresolved, e.g. as a HostAddr.
+type SOCKS5 struct {
+	// Addr of the proxy
+	Addr string
+
+	// User and Password enable username/password authentication (RFC 1929)
+	// when User is non-empty.
+	User, Password string
+
+	// Forward dials the proxy.  Defaults to a net.Dialer.
+	Forward NetDialer
+}
+
+// DialContext connects to the address through the proxy
+func (s SOCKS5) DialContext(c context.Context, network, address string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if s.User != "" {
+		auth = &proxy.Auth{User: s.User, Password: s.Password}
+	}
+
+	var fwd proxy.Dialer = new(net.Dialer)
+	if s.Forward != nil {
+		fwd = forwardDialer{s.Forward}
+	}
+
+	d, err := proxy.SOCKS5("tcp", s.Addr, auth, fwd)
+	if err != nil {
+		return nil, errors.Wrap(err, "socks5")
+	}
+
+	conn, err := d.(proxy.ContextDialer).DialContext(c, network, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "socks5")
+	}
+
+	return conn, nil
+}
+
+// forwardDialer adapts a NetDialer to proxy.ContextDialer
+type forwardDialer struct{ NetDialer }
+
+func (d forwardDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
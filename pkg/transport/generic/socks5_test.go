@@ -0,0 +1,195 @@
+package generic
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+// socksServer is a minimal SOCKS5 server supporting CONNECT and
+// username/password authentication.
+type socksServer struct {
+	net.Listener
+	user, pass string
+
+	mu    sync.Mutex
+	hosts []string // requested destinations
+}
+
+func mkSOCKSServer(t *testing.T, user, pass string) *socksServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &socksServer{Listener: l, user: user, pass: pass}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	target, err := s.handshake(conn)
+	if err != nil {
+		return
+	}
+	defer target.Close()
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func (s *socksServer) handshake(conn net.Conn) (net.Conn, error) {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil || hdr[0] != 5 {
+		return nil, errors.New("bad greeting")
+	}
+
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+
+	method := byte(0x00)
+	if s.user != "" {
+		method = 0x02
+	}
+
+	conn.Write([]byte{5, method})
+	if method == 0x02 {
+		if err := s.auth(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil || req[1] != 1 {
+		return nil, errors.New("unsupported command")
+	}
+
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n := make([]byte, 1)
+		io.ReadFull(conn, n)
+		name := make([]byte, n[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return nil, errors.New("unsupported address type")
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.hosts = append(s.hosts, host)
+	s.mu.Unlock()
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return target, nil
+}
+
+func (s *socksServer) auth(conn net.Conn) error {
+	ver := make([]byte, 2)
+	if _, err := io.ReadFull(conn, ver); err != nil {
+		return err
+	}
+
+	user := make([]byte, ver[1])
+	io.ReadFull(conn, user)
+
+	n := make([]byte, 1)
+	io.ReadFull(conn, n)
+	pass := make([]byte, n[0])
+	io.ReadFull(conn, pass)
+
+	if string(user) != s.user || string(pass) != s.pass {
+		conn.Write([]byte{1, 1})
+		return errors.New("auth failed")
+	}
+
+	conn.Write([]byte{1, 0})
+	return nil
+}
+
+func TestSOCKS5(t *testing.T) {
+	srv := mkSOCKSServer(t, "user", "secret")
+	defer srv.Close()
+
+	l, err := mkTCPTransport().Listen(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	dial := func(d NetDialer, a net.Addr) (dc, lc pipe.Conn, err error) {
+		var g errgroup.Group
+		g.Go(func() (err error) {
+			lc, err = l.Accept()
+			return
+		})
+		g.Go(func() (err error) {
+			dc, err = mkTCPTransport(OptDialer(d)).Dial(context.Background(), a)
+			return
+		})
+		err = g.Wait()
+		return
+	}
+
+	t.Run("Connect", func(t *testing.T) {
+		dc, lc, err := dial(SOCKS5{Addr: srv.Addr().String(), User: "user", Password: "secret"}, l.Addr())
+		if assert.NoError(t, err) {
+			testStream(t, dc, lc)
+		}
+	})
+
+	t.Run("RemoteDNS", func(t *testing.T) {
+		_, port, _ := net.SplitHostPort(l.Addr().String())
+		a := HostAddr{Net: "tcp", Host: net.JoinHostPort("localhost", port)}
+
+		dc, lc, err := dial(SOCKS5{Addr: srv.Addr().String(), User: "user", Password: "secret"}, a)
+		if assert.NoError(t, err) {
+			testStream(t, dc, lc)
+		}
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.Equal(t, "localhost", srv.hosts[len(srv.hosts)-1])
+	})
+
+	t.Run("AuthFailure", func(t *testing.T) {
+		d := SOCKS5{Addr: srv.Addr().String(), User: "user", Password: "wrong"}
+		_, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,83 @@
+package generic
+
+import (
+	"crypto/tls"
+	"net"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+)
+
+// TLSConn is a pipe.Conn that is secured by TLS.  Peers are identified by the
+// public key of their certificate.
+type TLSConn interface {
+	pipe.IdentifiedConn
+	ConnectionState() tls.ConnectionState
+}
+
+type tlsConn struct {
+	pipe.Conn
+	state tls.ConnectionState
+	local pipe.PeerID
+}
+
+func (c tlsConn) ConnectionState() tls.ConnectionState { return c.state }
+
+func (c tlsConn) LocalPeer() pipe.PeerID { return c.local }
+
+func (c tlsConn) RemotePeer() pipe.PeerID {
+	if len(c.state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return pipe.CertPeerID(c.state.PeerCertificates[0])
+}
+
+type tlsSecureConn struct {
+	*tls.Conn
+	cfg    *tls.Config
+	server bool
+}
+
+func (c tlsSecureConn) Wrap(conn pipe.Conn) pipe.Conn {
+	state := c.ConnectionState()
+
+	var hello *tls.ClientHelloInfo
+	if c.server {
+		hello = &tls.ClientHelloInfo{ServerName: state.ServerName, Conn: c.Conn.NetConn()}
+	}
+
+	return tlsConn{Conn: conn, state: state, local: pipe.TLSPeerID(c.cfg, hello)}
+}
+
+// TLSConfig is a SecurityAdapter that uses crypto/tls
+type TLSConfig struct{ *tls.Config }
+
+// SecureServer is called by the listener
+func (c TLSConfig) SecureServer(conn net.Conn) (SecureConn, error) {
+	tc := tls.Server(conn, c.Config)
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+
+	return tlsSecureConn{Conn: tc, cfg: c.Config, server: true}, nil
+}
+
+// SecureClient is called by the dialer
+func (c TLSConfig) SecureClient(conn net.Conn, a net.Addr) (SecureConn, error) {
+	cfg := c.Config
+
+	// As with tls.Dial, infer the server name from the address.
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(a.String()); err == nil {
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+	}
+
+	tc := tls.Client(conn, cfg)
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+
+	return tlsSecureConn{Conn: tc, cfg: cfg}, nil
+}
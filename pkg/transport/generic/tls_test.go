@@ -0,0 +1,131 @@
+package generic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func mkTCPTransport(opt ...Option) Transport {
+	return New(append([]Option{
+		OptListener(new(net.ListenConfig)),
+		OptDialer(new(net.Dialer)),
+	}, opt...)...)
+}
+
+func TestTLS(t *testing.T) {
+	cert, pool := transporttest.Cert(t)
+
+	// the listener obtains its certificate dynamically
+	lt := mkTCPTransport(OptTLS(&tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil },
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool,
+	}))
+
+	l, err := lt.Listen(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	t.Run("Succeed", func(t *testing.T) {
+		dt := mkTCPTransport(OptTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+		}))
+
+		var dc, lc pipe.Conn
+		var g errgroup.Group
+		g.Go(func() (err error) {
+			lc, err = l.Accept()
+			return
+		})
+		g.Go(func() (err error) {
+			dc, err = dt.Dial(context.Background(), l.Addr())
+			return
+		})
+		assert.NoError(t, g.Wait())
+
+		for _, conn := range []pipe.Conn{dc, lc} {
+			assert.Implements(t, (*TLSConn)(nil), conn)
+			state := conn.(TLSConn).ConnectionState()
+			assert.True(t, state.HandshakeComplete)
+			assert.Len(t, state.PeerCertificates, 1)
+
+			assert.Equal(t, pipe.CertPeerID(cert.Leaf), conn.(TLSConn).LocalPeer())
+			assert.Equal(t, pipe.CertPeerID(cert.Leaf), conn.(TLSConn).RemotePeer())
+		}
+
+		testStream(t, dc, lc)
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		dt := mkTCPTransport(OptTLS(&tls.Config{})) // does not trust the server
+
+		accepted := acceptAsync(l)
+
+		_, err := dt.Dial(context.Background(), l.Addr())
+		assert.Error(t, err)
+
+		select {
+		case <-accepted:
+			t.Error("failed handshake was accepted")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+// TestHandshakeStall checks that a peer that never completes its handshake does
+// not hold up the others.
+func TestHandshakeStall(t *testing.T) {
+	cert, pool := transporttest.Cert(t)
+
+	lt := mkTCPTransport(OptTLS(&tls.Config{Certificates: []tls.Certificate{cert}}))
+	l, err := lt.Listen(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	accepted := acceptAsync(l)
+
+	stalled, err := net.Dial("tcp", l.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stalled.Close()
+
+	dt := mkTCPTransport(OptTLS(&tls.Config{RootCAs: pool}))
+	c, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	dc, err := dt.Dial(c, l.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer dc.Close()
+
+	select {
+	case lc := <-accepted:
+		lc.Close()
+	case <-time.After(time.Second):
+		t.Error("accept blocked by a stalled handshake")
+	}
+}
+
+// acceptAsync returns the first connection accepted by the listener, if any
+func acceptAsync(l pipe.Listener) <-chan pipe.Conn {
+	ch := make(chan pipe.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			ch <- conn
+		}
+	}()
+	return ch
+}
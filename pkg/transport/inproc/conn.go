@@ -25,9 +25,10 @@ type conn struct {
 	clientSide    bool
 	idCtr         uint32
 	local, remote net.Addr
+	lpeer, rpeer  pipe.PeerID
 }
 
-func newConn(c context.Context, laddr, raddr net.Addr) (local *conn, remote *conn) {
+func newConn(c context.Context, laddr, raddr net.Addr, lpeer, rpeer pipe.PeerID) (local *conn, remote *conn) {
 	local = new(conn)
 	remote = new(conn)
 
@@ -37,6 +38,8 @@ func newConn(c context.Context, laddr, raddr net.Addr) (local *conn, remote *con
 	local.cancel = cancel
 	local.local = laddr
 	local.remote = raddr
+	local.lpeer = lpeer
+	local.rpeer = rpeer
 	local.ch = make(chan *stream)
 	local.rc = remote
 	local.clientSide = true // needed to set stream id
@@ -45,6 +48,8 @@ func newConn(c context.Context, laddr, raddr net.Addr) (local *conn, remote *con
 	remote.cancel = cancel
 	remote.local = raddr
 	remote.remote = laddr
+	remote.lpeer = rpeer
+	remote.rpeer = lpeer
 	remote.ch = make(chan *stream)
 	remote.rc = local
 
@@ -56,6 +61,9 @@ func (c *conn) Context() context.Context { return c.ctx }
 func (c *conn) LocalAddr() net.Addr  { return c.local }
 func (c *conn) RemoteAddr() net.Addr { return c.remote }
 
+func (c *conn) LocalPeer() pipe.PeerID  { return c.lpeer }
+func (c *conn) RemotePeer() pipe.PeerID { return c.rpeer }
+
 func (c *conn) AcceptStream() (pipe.Stream, error) {
 	select {
 	case <-c.ctx.Done():
@@ -70,17 +78,7 @@ func (c *conn) AcceptStream() (pipe.Stream, error) {
 
 func (c *conn) OpenStream() (pipe.Stream, error) {
 	ctx, cancel := context.WithCancel(c.ctx)
-	lp, rp := net.Pipe()
-
-	local := new(stream)
-	local.ctx = ctx
-	local.cancel = cancel
-	local.Conn = lp
-
-	remote := new(stream)
-	remote.ctx = ctx
-	remote.cancel = cancel
-	remote.Conn = rp
+	local, remote := newStreamPair(ctx, cancel)
 
 	// client-initiated streams have even-numbered IDs.
 	// server-initiated streams have odd-numbered IDs.
@@ -108,9 +106,10 @@ func (c *conn) Connect(s *stream) (err error) {
 
 func (c *conn) Close() (err error) {
 	err = errors.New("already closed")
+	// c.ch is left open, as the remote end may be sending on it.  Canceling
+	// the shared context unblocks both ends.
 	c.o.Do(func() {
 		c.cancel()
-		close(c.ch)
 		err = nil
 	})
 	return
@@ -3,6 +3,7 @@ package inproc
 import (
 	"context"
 	"net"
+	"net/url"
 	"sync"
 
 	pipe "github.com/lthibault/pipewerks/pkg"
@@ -11,6 +12,16 @@ import (
 
 const network = "inproc"
 
+// urlTransport is shared by all inproc URLs so that access to the
+// DefaultNamespace is synchronized.
+var urlTransport = New()
+
+func init() {
+	pipe.Register(network, func(u *url.URL) (pipe.Transport, net.Addr, error) {
+		return urlTransport, Addr(u.Host + u.Path), nil
+	})
+}
+
 // ReverseDialer can provide a dialback address
 type ReverseDialer interface {
 	Dialback() Addr
@@ -23,10 +34,17 @@ type Addr string
 func (Addr) Network() string  { return network }
 func (a Addr) String() string { return string(a) }
 
+// Identifier can provide the PeerID of the transport bound to an address.
+// Connectors that satisfy it allow conns to report their RemotePeer.
+type Identifier interface {
+	PeerID() pipe.PeerID
+}
+
 // Transport bytes around the process
 type Transport struct {
 	mu sync.RWMutex
 	ns Namespace
+	id pipe.PeerID
 }
 
 func (t *Transport) gc(addr string) func() {
@@ -47,6 +65,7 @@ func (t *Transport) Listen(_ context.Context, a net.Addr) (pipe.Listener, error)
 	}
 
 	l := newListener(Addr(a.String()), t.gc(a.String()))
+	l.id = t.id
 	if ok := t.ns.Bind(a.String(), l); !ok {
 		return nil, errors.Errorf("%s: address in use", a.String())
 	}
@@ -68,13 +87,18 @@ func (t *Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
 		laddr = r.Dialback()
 	}
 
-	local, remote := newConn(context.Background(), laddr, a)
-
 	l, ok := t.ns.GetConnector(a.String())
 	if !ok {
 		return nil, errors.New("connection refused")
 	}
 
+	var rpeer pipe.PeerID
+	if i, ok := l.(Identifier); ok {
+		rpeer = i.PeerID()
+	}
+
+	local, remote := newConn(context.Background(), laddr, a, t.id, rpeer)
+
 	if err := l.Connect(c, remote); err != nil {
 		return nil, err
 	}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/sync/errgroup"
@@ -151,3 +152,90 @@ func BenchmarkTransmission(b *testing.B) {
 		}
 	}
 }
+
+func TestHalfClose(t *testing.T) {
+	tp := New(OptNamespace(make(namespace)))
+
+	l, err := tp.Listen(context.Background(), Addr("/test"))
+	assert.NoError(t, err)
+	defer l.Close()
+
+	var dc, lc pipe.Conn
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		lc, err = l.Accept()
+		return
+	})
+	g.Go(func() (err error) {
+		dc, err = tp.Dial(context.Background(), Addr("/test"))
+		return
+	})
+	assert.NoError(t, g.Wait(), "canary failed")
+
+	transporttest.HalfClose(t, dc, lc)
+}
+
+func TestURL(t *testing.T) {
+	l, err := pipe.ListenURL(context.Background(), "inproc:///url")
+	assert.NoError(t, err)
+	assert.Equal(t, Addr("/url"), l.Addr())
+	defer l.Close()
+
+	var g errgroup.Group
+	g.Go(func() error {
+		_, err := l.Accept()
+		return err
+	})
+
+	_, err = pipe.DialURL(context.Background(), "inproc:///url")
+	assert.NoError(t, err)
+	assert.NoError(t, g.Wait())
+}
+
+func TestPeerID(t *testing.T) {
+	ns := make(namespace)
+	lt := New(OptNamespace(ns), OptPeerID(pipe.PeerID("listener")))
+	dt := New(OptNamespace(ns), OptPeerID(pipe.PeerID("dialer")))
+
+	l, err := lt.Listen(context.Background(), Addr("/test"))
+	assert.NoError(t, err)
+	defer l.Close()
+
+	var lc, dc pipe.Conn
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		lc, err = l.Accept()
+		return
+	})
+	g.Go(func() (err error) {
+		dc, err = dt.Dial(context.Background(), Addr("/test"))
+		return
+	})
+	assert.NoError(t, g.Wait())
+
+	assert.Equal(t, pipe.PeerID("dialer"), dc.(pipe.IdentifiedConn).LocalPeer())
+	assert.Equal(t, pipe.PeerID("listener"), dc.(pipe.IdentifiedConn).RemotePeer())
+
+	assert.Equal(t, pipe.PeerID("listener"), lc.(pipe.IdentifiedConn).LocalPeer())
+	assert.Equal(t, pipe.PeerID("dialer"), lc.(pipe.IdentifiedConn).RemotePeer())
+}
+
+func TestOpenStreamClosed(t *testing.T) {
+	local, remote := newConn(context.Background(), Addr("/local"), Addr("/remote"), nil, nil)
+
+	opened := make(chan error, 1)
+	go func() {
+		_, err := local.OpenStream() // blocks, as remote does not accept
+		opened <- err
+	}()
+
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, remote.Close())
+	assert.Error(t, <-opened)
+
+	// the remote end is closed before streams are opened
+	for i := 0; i < 100; i++ {
+		_, err := local.OpenStream()
+		assert.Error(t, err)
+	}
+}
@@ -14,6 +14,7 @@ type listener struct {
 	cq      chan struct{}
 	ch      chan pipe.Conn
 	a       Addr
+	id      pipe.PeerID
 	release func()
 }
 
@@ -28,6 +29,9 @@ func newListener(a Addr, gc func()) *listener {
 
 func (l *listener) Addr() net.Addr { return l.a }
 
+// PeerID of the transport that is listening
+func (l *listener) PeerID() pipe.PeerID { return l.id }
+
 func (l *listener) Close() (err error) {
 	err = errors.New("already closed")
 
@@ -1,5 +1,7 @@
 package inproc
 
+import pipe "github.com/lthibault/pipewerks/pkg"
+
 // Option for inproc transport
 type Option func(*Transport) Option
 
@@ -11,3 +13,13 @@ func OptNamespace(ns Namespace) Option {
 		return
 	}
 }
+
+// OptPeerID sets the identity reported by conns' LocalPeer method, and by the
+// RemotePeer method of the conns at the other end.
+func OptPeerID(id pipe.PeerID) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptPeerID(t.id)
+		t.id = id
+		return
+	}
+}
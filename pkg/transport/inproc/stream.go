@@ -3,6 +3,7 @@ package inproc
 import (
 	"context"
 	"net"
+	"time"
 )
 
 type stream struct {
@@ -10,18 +11,48 @@ type stream struct {
 	cancel func()
 
 	id uint32
-	net.Conn
+
+	// Each direction is carried by a separate net.Pipe so that either one can
+	// be closed independently of the other.
+	r, w net.Conn
+}
+
+func newStreamPair(c context.Context, cancel func()) (local, remote *stream) {
+	lr, rw := net.Pipe()
+	rr, lw := net.Pipe()
+
+	local = &stream{ctx: c, cancel: cancel, r: lr, w: lw}
+	remote = &stream{ctx: c, cancel: cancel, r: rr, w: rw}
+	return
 }
 
 func (s stream) Context() context.Context { return s.ctx }
 func (s stream) StreamID() uint32         { return s.id }
 
-func (s stream) LocalAddr() net.Addr  { return addrWrapper{s.Conn.LocalAddr()} }
-func (s stream) RemoteAddr() net.Addr { return addrWrapper{s.Conn.RemoteAddr()} }
+func (s stream) LocalAddr() net.Addr  { return addrWrapper{s.r.LocalAddr()} }
+func (s stream) RemoteAddr() net.Addr { return addrWrapper{s.r.RemoteAddr()} }
+
+func (s stream) Read(b []byte) (int, error)  { return s.r.Read(b) }
+func (s stream) Write(b []byte) (int, error) { return s.w.Write(b) }
+
+func (s stream) SetDeadline(t time.Time) error {
+	if err := s.r.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return s.w.SetWriteDeadline(t)
+}
+
+func (s stream) SetReadDeadline(t time.Time) error  { return s.r.SetReadDeadline(t) }
+func (s stream) SetWriteDeadline(t time.Time) error { return s.w.SetWriteDeadline(t) }
+
+func (s stream) CloseRead() error  { return s.r.Close() }
+func (s stream) CloseWrite() error { return s.w.Close() }
 
 func (s stream) Close() error {
 	s.cancel()
-	return s.Conn.Close()
+	s.r.Close()
+	return s.w.Close()
 }
 
 type addrWrapper struct{ net.Addr }
@@ -0,0 +1,139 @@
+package kcp
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+// hello is sent by the dialer when the session is opened.  KCP has no handshake
+// of its own, so the listener would otherwise not learn of the session until the
+// dialer sends data, which the multiplexer may never do.
+const hello = 0x01
+
+// Config for KCP sessions.  It satisfies both generic.NetDialer and
+// generic.NetListener.
+type Config struct {
+	// MTU is the maximum size of a UDP payload, including all headers.
+	MTU int
+
+	// SndWnd and RcvWnd are the window sizes, in packets.
+	SndWnd, RcvWnd int
+
+	// NoDelay, Interval, Resend and NoCongestion tune the protocol for latency.
+	// See OptNoDelay.
+	NoDelay, Interval, Resend, NoCongestion int
+
+	// DataShards and ParityShards configure forward error correction.  FEC is
+	// disabled if either is zero.
+	DataShards, ParityShards int
+
+	// Block is optional.  If set, packets are encrypted.  See OptBlockCrypt.
+	Block kcp.BlockCrypt
+}
+
+// DefaultConfig favors latency over bandwidth efficiency
+var DefaultConfig = Config{
+	MTU:          1350,
+	SndWnd:       128,
+	RcvWnd:       512,
+	NoDelay:      1,
+	Interval:     20,
+	Resend:       2,
+	NoCongestion: 1,
+}
+
+func (c Config) apply(s *kcp.UDPSession) error {
+	if !s.SetMtu(c.MTU) {
+		return errors.Errorf("kcp: invalid MTU %d", c.MTU)
+	}
+
+	s.SetStreamMode(true)
+	s.SetWindowSize(c.SndWnd, c.RcvWnd)
+	s.SetNoDelay(c.NoDelay, c.Interval, c.Resend, c.NoCongestion)
+	return nil
+}
+
+// DialContext opens a KCP session over a new UDP socket.  The network is
+// ignored, as kcp-go selects it from the address.
+func (c Config) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	s, err := kcp.DialWithOptions(address, c.Block, c.DataShards, c.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.apply(s); err == nil {
+		_, err = s.Write([]byte{hello})
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Listen for KCP sessions on a UDP socket.  The network is ignored, as kcp-go
+// selects it from the address.
+func (c Config) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	l, err := kcp.ListenWithOptions(address, c.Block, c.DataShards, c.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	return listener{Listener: l, c: c}, nil
+}
+
+type listener struct {
+	*kcp.Listener
+	c Config
+}
+
+func (l listener) Accept() (net.Conn, error) {
+	for {
+		s, err := l.AcceptKCP()
+		if err != nil {
+			return nil, err
+		}
+
+		if err = l.c.apply(s); err == nil {
+			return &session{UDPSession: s}, nil
+		}
+
+		s.Close()
+	}
+}
+
+// session discards the dialer's hello before the first read.  This is done
+// lazily, so that Accept does not wait on the remote end.
+type session struct {
+	*kcp.UDPSession
+
+	mu      sync.Mutex
+	greeted bool
+}
+
+func (s *session) Read(b []byte) (int, error) {
+	s.mu.Lock()
+	if !s.greeted {
+		var h [1]byte
+		if _, err := s.UDPSession.Read(h[:]); err != nil {
+			s.mu.Unlock()
+			return 0, err
+		}
+
+		if h[0] != hello {
+			s.mu.Unlock()
+			s.Close()
+			return 0, errors.New("kcp: malformed handshake")
+		}
+
+		s.greeted = true
+	}
+	s.mu.Unlock()
+
+	return s.UDPSession.Read(b)
+}
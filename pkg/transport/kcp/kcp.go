@@ -0,0 +1,66 @@
+package kcp
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+func init() { pipe.Register("kcp", fromURL) }
+
+func fromURL(u *url.URL) (pipe.Transport, net.Addr, error) {
+	a, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "kcp")
+	}
+
+	return New(), a, nil
+}
+
+func checkNetwork(a net.Addr) (ok bool) {
+	switch a.Network() {
+	case "udp", "udp4", "udp6":
+		ok = true
+	}
+
+	return
+}
+
+// Transport over KCP, using github.com/xtaci/kcp-go.  KCP provides reliable,
+// ordered delivery over UDP, with optional forward error correction and
+// encryption.
+type Transport struct{ generic.Transport }
+
+// Listen KCP
+func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("kcp: invalid network %s", a.Network())
+	}
+
+	return t.Transport.Listen(c, a)
+}
+
+// Dial KCP
+func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("kcp: invalid network %s", a.Network())
+	}
+
+	return t.Transport.Dial(c, a)
+}
+
+// New KCP Transport
+func New(opt ...Option) (t Transport) {
+	t.Transport = generic.New()
+	OptConfig(DefaultConfig)(&t)
+
+	for _, fn := range opt {
+		fn(&t)
+	}
+
+	return t
+}
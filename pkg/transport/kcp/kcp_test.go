@@ -0,0 +1,68 @@
+package kcp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/stretchr/testify/assert"
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+var loopback = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+func TestIntegration(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		transporttest.Run(t, New(), loopback)
+	})
+
+	t.Run("Smux", func(t *testing.T) {
+		transporttest.Run(t, New(OptGeneric(generic.OptMuxAdapter(generic.SmuxConfig{}))), loopback)
+	})
+
+	t.Run("FEC", func(t *testing.T) {
+		transporttest.Run(t, New(OptFEC(10, 3)), loopback)
+	})
+
+	t.Run("BlockCrypt", func(t *testing.T) {
+		bc, err := kcp.NewAESBlockCrypt(make([]byte, 32))
+		assert.NoError(t, err)
+
+		transporttest.Run(t, New(
+			OptFEC(10, 3),
+			OptBlockCrypt(bc),
+			OptWindow(256, 256),
+			OptNoDelay(0, 40, 0, 0),
+		), loopback)
+	})
+}
+
+func TestCheckNetwork(t *testing.T) {
+	_, err := New().Dial(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+
+	_, err = New().Listen(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+}
+
+func TestURL(t *testing.T) {
+	tp, a, err := pipe.DefaultRegistry.Resolve("kcp://127.0.0.1:9001")
+	assert.NoError(t, err)
+	assert.IsType(t, Transport{}, tp)
+	assert.Equal(t, "udp", a.Network())
+	assert.Equal(t, "127.0.0.1:9001", a.String())
+}
+
+func TestOptions(t *testing.T) {
+	tp := New()
+	prev := OptFEC(10, 3)(&tp)
+	assert.Equal(t, 10, tp.config().DataShards)
+	assert.Equal(t, 3, tp.config().ParityShards)
+
+	prev(&tp)
+	assert.Zero(t, tp.config().DataShards)
+	assert.Equal(t, DefaultConfig.SndWnd, tp.config().SndWnd)
+}
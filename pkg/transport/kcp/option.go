@@ -0,0 +1,89 @@
+package kcp
+
+import (
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+// Option for KCP transport
+type Option func(*Transport) (prev Option)
+
+// OptConfig sets the session configuration for both dialer and listener
+func OptConfig(c Config) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptConfig(t.config())
+		OptGeneric(generic.OptDialer(c))(t)
+		OptGeneric(generic.OptListener(c))(t)
+		return
+	}
+}
+
+// OptFEC enables Reed-Solomon forward error correction, adding parityShards
+// parity packets for every dataShards data packets.  Passing zero for either
+// disables FEC.  Both ends MUST use the same parameters.
+func OptFEC(dataShards, parityShards int) Option {
+	return func(t *Transport) (prev Option) {
+		c := t.config()
+		prev = OptFEC(c.DataShards, c.ParityShards)
+		c.DataShards, c.ParityShards = dataShards, parityShards
+		OptConfig(c)(t)
+		return
+	}
+}
+
+// OptWindow sets the send and receive window sizes, in packets
+func OptWindow(snd, rcv int) Option {
+	return func(t *Transport) (prev Option) {
+		c := t.config()
+		prev = OptWindow(c.SndWnd, c.RcvWnd)
+		c.SndWnd, c.RcvWnd = snd, rcv
+		OptConfig(c)(t)
+		return
+	}
+}
+
+// OptNoDelay tunes the protocol for latency.  nodelay enables a lower minimum
+// retransmission timeout, interval is the internal update period in milliseconds,
+// resend is the number of duplicate acks that trigger a fast retransmission (zero
+// disables it) and nc disables congestion control.
+func OptNoDelay(nodelay, interval, resend, nc int) Option {
+	return func(t *Transport) (prev Option) {
+		c := t.config()
+		prev = OptNoDelay(c.NoDelay, c.Interval, c.Resend, c.NoCongestion)
+		c.NoDelay, c.Interval, c.Resend, c.NoCongestion = nodelay, interval, resend, nc
+		OptConfig(c)(t)
+		return
+	}
+}
+
+// OptBlockCrypt encrypts packets with one of kcp-go's block ciphers, e.g.
+// kcp.NewAESBlockCrypt.  Passing nil disables encryption.  Both ends MUST use the
+// same BlockCrypt.
+//
+// Packets are checksummed, but not authenticated, so this obfuscates traffic
+// rather than securing it.  Use generic.OptTLS or generic.OptNoise to secure
+// connections.
+func OptBlockCrypt(b kcp.BlockCrypt) Option {
+	return func(t *Transport) (prev Option) {
+		c := t.config()
+		prev = OptBlockCrypt(c.Block)
+		c.Block = b
+		OptConfig(c)(t)
+		return
+	}
+}
+
+// OptGeneric sets an option on the underlying generic transport
+func OptGeneric(opt generic.Option) Option {
+	return func(t *Transport) Option {
+		return OptGeneric(opt(&t.Transport))
+	}
+}
+
+func (t Transport) config() Config {
+	if c, ok := t.Transport.NetDialer.(Config); ok {
+		return c
+	}
+
+	return DefaultConfig
+}
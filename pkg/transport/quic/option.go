@@ -3,7 +3,8 @@ package quic
 import (
 	"crypto/tls"
 
-	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	quic "github.com/quic-go/quic-go"
 )
 
 // Option for Transport
@@ -18,7 +19,8 @@ func OptQuic(q *quic.Config) Option {
 	}
 }
 
-// OptTLS sets the TLS configuration
+// OptTLS sets the TLS configuration.  If it names no application protocols,
+// NextProto is negotiated.
 func OptTLS(tc *tls.Config) Option {
 	return func(t *Transport) (prev Option) {
 		prev = OptTLS(t.t)
@@ -26,3 +28,13 @@ func OptTLS(tc *tls.Config) Option {
 		return
 	}
 }
+
+// OptPacketListener sets the source of the UDP sockets used by listeners, e.g.
+// a net.ListenConfig.  By default, quic-go binds its own.
+func OptPacketListener(pl generic.PacketListener) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptPacketListener(t.pl)
+		t.pl = pl
+		return
+	}
+}
@@ -4,37 +4,67 @@ import (
 	"context"
 	"crypto/tls"
 	"net"
+	"net/url"
 
 	"github.com/SentimensRG/ctx"
 	pipe "github.com/lthibault/pipewerks/pkg"
-	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
 	"github.com/pkg/errors"
+	quic "github.com/quic-go/quic-go"
 )
 
 // Config for QUIC protocol
 type Config = quic.Config
 
+// NextProto is the application protocol that is negotiated when the TLS
+// configuration names none, as QUIC requires one.
+const NextProto = "pipewerks"
+
 type addresser interface {
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 }
 
-type conn struct{ quic.Session }
+type conn struct {
+	quic.Connection
+	local pipe.PeerID
+}
+
+func mkConn(c quic.Connection, tc *tls.Config, server bool) *conn {
+	var hello *tls.ClientHelloInfo
+	if server {
+		hello = &tls.ClientHelloInfo{ServerName: c.ConnectionState().TLS.ServerName}
+	}
+
+	return &conn{Connection: c, local: pipe.TLSPeerID(tc, hello)}
+}
+
+// LocalPeer is derived from the certificate in the TLS configuration, as in
+// pipe.TLSPeerID
+func (c conn) LocalPeer() pipe.PeerID { return c.local }
+
+// RemotePeer is derived from the certificate presented by the remote peer
+func (c conn) RemotePeer() pipe.PeerID {
+	if certs := c.ConnectionState().TLS.PeerCertificates; len(certs) > 0 {
+		return pipe.CertPeerID(certs[0])
+	}
 
-func mkConn(s quic.Session) *conn {
-	return &conn{Session: s}
+	return nil
 }
 
 func (c conn) AcceptStream() (pipe.Stream, error) {
-	s, err := c.Session.AcceptStream()
+	s, err := c.Connection.AcceptStream(context.Background())
 	return stream{Stream: s, addresser: c}, err
 }
 
 func (c conn) OpenStream() (pipe.Stream, error) {
-	s, err := c.Session.OpenStream()
+	s, err := c.Connection.OpenStream()
 	return stream{Stream: s, addresser: c}, err
 }
 
+// Close the connection without an error code
+func (c conn) Close() error { return c.CloseWithError(0, "") }
+
 type stream struct {
 	quic.Stream
 	addresser
@@ -42,6 +72,35 @@ type stream struct {
 
 func (s stream) StreamID() uint32 { return uint32(s.Stream.StreamID()) }
 
+// CloseRead aborts receiving on the stream
+func (s stream) CloseRead() error {
+	s.Stream.CancelRead(0)
+	return nil
+}
+
+// CloseWrite closes the write-direction of the stream
+func (s stream) CloseWrite() error { return s.Stream.Close() }
+
+// Close both directions of the stream
+func (s stream) Close() error {
+	s.Stream.CancelRead(0)
+	return s.Stream.Close()
+}
+
+// The default registration uses a Transport without TLS configuration, which is
+// only suitable for dialing.  Applications should register their own factory in
+// order to listen.
+func init() { pipe.Register("quic", fromURL) }
+
+func fromURL(u *url.URL) (pipe.Transport, net.Addr, error) {
+	a, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "quic")
+	}
+
+	return New(), a, nil
+}
+
 func checkNetwork(a net.Addr) (ok bool) {
 	switch a.Network() {
 	case "udp", "udp4", "udp6":
@@ -53,8 +112,9 @@ func checkNetwork(a net.Addr) (ok bool) {
 
 // Transport over QUIC
 type Transport struct {
-	q *Config
-	t *tls.Config
+	q  *Config
+	t  *tls.Config
+	pl generic.PacketListener
 }
 
 // Dial the specified address
@@ -63,12 +123,12 @@ func (t *Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
 		return nil, errors.Errorf("quic: invalid network %s", a.Network())
 	}
 
-	sess, err := quic.DialAddrContext(c, a.String(), t.t, t.q)
+	qc, err := quic.DialAddr(c, a.String(), t.tlsConfig(), t.q)
 	if err != nil {
 		return nil, errors.Wrap(err, "dial")
 	}
 
-	return mkConn(sess), nil
+	return mkConn(qc, t.t, false), nil
 }
 
 // Listen on the specified address
@@ -77,24 +137,80 @@ func (t *Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error)
 		return nil, errors.Errorf("quic: invalid network %s", a.Network())
 	}
 
-	l, err := quic.ListenAddr(a.String(), t.t, t.q)
+	l, err := t.listen(c, a)
 	if err != nil {
 		return nil, err
 	}
 	ctx.Defer(c, func() { l.Close() })
 
-	return listener{l}, nil
+	return listener{quicListener: l, t: t.t}, nil
 }
 
-type listener struct{ quic.Listener }
+// tlsConfig with an application protocol
+func (t *Transport) tlsConfig() *tls.Config {
+	if t.t != nil && len(t.t.NextProtos) > 0 {
+		return t.t
+	}
+
+	tc := new(tls.Config)
+	if t.t != nil {
+		tc = t.t.Clone()
+	}
+
+	tc.NextProtos = []string{NextProto}
+	return tc
+}
+
+type quicListener interface {
+	Accept(context.Context) (quic.Connection, error)
+	Addr() net.Addr
+	Close() error
+}
+
+func (t *Transport) listen(c context.Context, a net.Addr) (quicListener, error) {
+	if t.pl == nil {
+		return quic.ListenAddr(a.String(), t.tlsConfig(), t.q)
+	}
+
+	pc, err := t.pl.ListenPacket(c, a.Network(), a.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "listen packet")
+	}
+
+	l, err := quic.Listen(pc, t.tlsConfig(), t.q)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	return ownedListener{Listener: l, pc: pc}, nil
+}
+
+// ownedListener closes the PacketConn that it was created with, which quic-go
+// leaves open.
+type ownedListener struct {
+	*quic.Listener
+	pc net.PacketConn
+}
+
+func (l ownedListener) Close() error {
+	err := l.Listener.Close()
+	l.pc.Close()
+	return err
+}
+
+type listener struct {
+	quicListener
+	t *tls.Config
+}
 
 func (l listener) Accept() (conn pipe.Conn, err error) {
-	sess, err := l.Listener.Accept()
+	qc, err := l.quicListener.Accept(context.Background())
 	if err != nil {
 		return nil, errors.Wrap(err, "accept")
 	}
 
-	return mkConn(sess), nil
+	return mkConn(qc, l.t, true), nil
 }
 
 // New Transport over QUIC
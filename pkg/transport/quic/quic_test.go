@@ -0,0 +1,155 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+var loopback = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+// mkTransports that authenticate each other with the same certificate
+func mkTransports(t *testing.T) (dt, lt *Transport, cert tls.Certificate) {
+	cert, pool := transporttest.Cert(t)
+
+	dt = New(OptTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}))
+
+	// the listener obtains its certificate dynamically
+	lt = New(OptTLS(&tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil },
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool,
+	}))
+
+	return
+}
+
+func mkConns(t *testing.T) (dc, lc pipe.Conn, cleanup func()) {
+	dt, lt, _ := mkTransports(t)
+
+	l, err := lt.Listen(context.Background(), loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		lc, err = l.Accept()
+		return
+	})
+	g.Go(func() (err error) {
+		dc, err = dt.Dial(context.Background(), l.Addr())
+		return
+	})
+	if err = g.Wait(); err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+
+	return dc, lc, func() {
+		dc.Close()
+		lc.Close()
+		l.Close()
+	}
+}
+
+func TestIntegration(t *testing.T) {
+	dt, lt, _ := mkTransports(t)
+
+	l, err := lt.Listen(context.Background(), loopback)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	transporttest.RunListener(t, dt, l, l.Addr())
+}
+
+func TestHalfClose(t *testing.T) {
+	dc, lc, cleanup := mkConns(t)
+	defer cleanup()
+
+	transporttest.HalfClose(t, dc, lc)
+}
+
+func TestPeerID(t *testing.T) {
+	dt, lt, cert := mkTransports(t)
+
+	l, err := lt.Listen(context.Background(), loopback)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	var dc, lc pipe.Conn
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		lc, err = l.Accept()
+		return
+	})
+	g.Go(func() (err error) {
+		dc, err = dt.Dial(context.Background(), l.Addr())
+		return
+	})
+	if !assert.NoError(t, g.Wait()) {
+		return
+	}
+	defer dc.Close()
+	defer lc.Close()
+
+	id := pipe.CertPeerID(cert.Leaf)
+	for _, conn := range []pipe.Conn{dc, lc} {
+		assert.Implements(t, (*pipe.IdentifiedConn)(nil), conn)
+		assert.Equal(t, id, conn.(pipe.IdentifiedConn).LocalPeer())
+		assert.Equal(t, id, conn.(pipe.IdentifiedConn).RemotePeer())
+	}
+}
+
+func TestPacketListener(t *testing.T) {
+	dt, lt, _ := mkTransports(t)
+	OptPacketListener(new(net.ListenConfig))(lt)
+
+	l, err := lt.Listen(context.Background(), loopback)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var g errgroup.Group
+	g.Go(func() error {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	})
+
+	conn, err := dt.Dial(context.Background(), l.Addr())
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+	assert.NoError(t, g.Wait())
+
+	// the socket is closed along with the listener
+	assert.NoError(t, l.Close())
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if assert.NoError(t, err) {
+		pc.Close()
+	}
+}
+
+func TestCheckNetwork(t *testing.T) {
+	_, err := New().Dial(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+
+	_, err = New().Listen(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,207 @@
+package shm
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+var errClosed = errors.New("shm: use of closed connection")
+
+// conn is a net.Conn over a pair of rings.  Eventfds signal the availability of
+// data or space in a ring.  Each one is waited upon by a single party: the
+// consumer of a ring waits on its data eventfd, and the producer on its space
+// eventfd.
+type conn struct {
+	ctl           *net.UnixConn
+	local, remote net.Addr
+
+	seg     []byte
+	in, out *ring
+
+	rdata, rspace *os.File // for the inbound ring
+	wdata, wspace *os.File // for the outbound ring
+
+	rmu, wmu sync.Mutex
+
+	closed, gone int32
+	once         sync.Once
+}
+
+func newConn(ctl *net.UnixConn, seg []byte, in, out *ring, efd []*os.File, dialer bool) *conn {
+	c := &conn{
+		ctl:    ctl,
+		local:  Addr(ctl.LocalAddr().String()),
+		remote: Addr(ctl.RemoteAddr().String()),
+		seg:    seg,
+		in:     in,
+		out:    out,
+	}
+
+	// eventfds are ordered by ring, then data before space
+	if dialer {
+		c.wdata, c.wspace, c.rdata, c.rspace = efd[0], efd[1], efd[2], efd[3]
+	} else {
+		c.rdata, c.rspace, c.wdata, c.wspace = efd[0], efd[1], efd[2], efd[3]
+	}
+
+	go c.monitor()
+	return c
+}
+
+// monitor the control socket.  The peer sends nothing on it after the
+// handshake, so any return from Read means it has gone.
+func (c *conn) monitor() {
+	var b [1]byte
+	c.ctl.Read(b[:])
+
+	atomic.StoreInt32(&c.gone, 1)
+	signal(c.rdata)
+	signal(c.wspace)
+}
+
+func (c *conn) isClosed() bool { return atomic.LoadInt32(&c.closed) == 1 }
+func (c *conn) isGone() bool   { return atomic.LoadInt32(&c.gone) == 1 }
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		if c.isClosed() {
+			return 0, errClosed
+		}
+
+		// observe closure before reading, so that no data is lost
+		eof := isSet(c.in.wclosed) || c.isGone()
+		if n := c.in.read(b); n > 0 {
+			if consume(c.in.wwait) {
+				signal(c.rspace)
+			}
+			return n, nil
+		}
+
+		if eof {
+			return 0, io.EOF
+		}
+
+		set(c.in.rwait)
+		if c.in.len() > 0 || isSet(c.in.wclosed) {
+			continue
+		}
+
+		if err := wait(c.rdata); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *conn) Write(b []byte) (n int, err error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	for len(b) > 0 {
+		if c.isClosed() {
+			return n, errClosed
+		}
+
+		if isSet(c.out.rclosed) || c.isGone() {
+			return n, io.ErrClosedPipe
+		}
+
+		if k := c.out.write(b); k > 0 {
+			n += k
+			b = b[k:]
+			if consume(c.out.rwait) {
+				signal(c.wdata)
+			}
+			continue
+		}
+
+		set(c.out.wwait)
+		if c.out.free() > 0 || isSet(c.out.rclosed) {
+			continue
+		}
+
+		if err = wait(c.wspace); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Close the connection.  Buffered data remains readable by the peer.
+func (c *conn) Close() (err error) {
+	c.once.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		set(c.out.wclosed)
+		set(c.in.rclosed)
+
+		// wake the peer, then any local goroutines
+		signal(c.wdata)
+		signal(c.rspace)
+		signal(c.rdata)
+		signal(c.wspace)
+
+		// wait for local goroutines to leave the segment before unmapping it
+		c.rmu.Lock()
+		c.wmu.Lock()
+		defer c.rmu.Unlock()
+		defer c.wmu.Unlock()
+
+		err = c.ctl.Close()
+		unix.Munmap(c.seg)
+		for _, f := range []*os.File{c.rdata, c.rspace, c.wdata, c.wspace} {
+			f.Close()
+		}
+	})
+
+	return
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.SetWriteDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error  { return c.rdata.SetReadDeadline(t) }
+func (c *conn) SetWriteDeadline(t time.Time) error { return c.wspace.SetReadDeadline(t) }
+
+// signal increments an eventfd counter
+func signal(f *os.File) {
+	var b [8]byte
+	*(*uint64)(unsafe.Pointer(&b[0])) = 1 // host byte order
+	f.Write(b[:])
+}
+
+// wait until an eventfd counter is non-zero, and reset it
+func wait(f *os.File) error {
+	var b [8]byte
+	if _, err := f.Read(b[:]); err != nil {
+		if os.IsTimeout(err) {
+			return err
+		}
+
+		return errClosed
+	}
+
+	return nil
+}
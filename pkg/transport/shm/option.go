@@ -0,0 +1,44 @@
+package shm
+
+import (
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+)
+
+// Option for shared memory transport
+type Option func(*Transport) (prev Option)
+
+// OptConfig sets the configuration for both dialer and listener
+func OptConfig(c Config) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptConfig(t.config())
+		OptGeneric(generic.OptDialer(c))(t)
+		OptGeneric(generic.OptListener(c))(t)
+		return
+	}
+}
+
+// OptRingSize sets the capacity of the ring buffers allocated by the dialer
+func OptRingSize(n int) Option {
+	return func(t *Transport) (prev Option) {
+		c := t.config()
+		prev = OptRingSize(c.RingSize)
+		c.RingSize = n
+		OptConfig(c)(t)
+		return
+	}
+}
+
+// OptGeneric sets an option on the underlying generic transport
+func OptGeneric(opt generic.Option) Option {
+	return func(t *Transport) Option {
+		return OptGeneric(opt(&t.Transport))
+	}
+}
+
+func (t Transport) config() Config {
+	if c, ok := t.Transport.NetDialer.(Config); ok {
+		return c
+	}
+
+	return DefaultConfig
+}
@@ -0,0 +1,91 @@
+package shm
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Each ring begins with a header page.  Counters written by different
+// processes live on separate cache lines.
+const (
+	offHead    = 0   // read index, written by the consumer
+	offTail    = 64  // write index, written by the producer
+	offRWait   = 128 // consumer is waiting for data
+	offWWait   = 192 // producer is waiting for space
+	offWClosed = 256 // producer will not write again
+	offRClosed = 320 // consumer will not read again
+
+	ringHeaderSize = 4096
+)
+
+// ring is a single-producer, single-consumer byte queue in shared memory.  The
+// indices increase monotonically and are reduced modulo the capacity, which is
+// a power of two.
+type ring struct {
+	buf  []byte
+	mask uint64
+
+	head, tail       *uint64
+	rwait, wwait     *uint32
+	wclosed, rclosed *uint32
+}
+
+// newRing over mem, which holds the header followed by the buffer
+func newRing(mem []byte) *ring {
+	return &ring{
+		buf:     mem[ringHeaderSize:],
+		mask:    uint64(len(mem) - ringHeaderSize - 1),
+		head:    (*uint64)(unsafe.Pointer(&mem[offHead])),
+		tail:    (*uint64)(unsafe.Pointer(&mem[offTail])),
+		rwait:   (*uint32)(unsafe.Pointer(&mem[offRWait])),
+		wwait:   (*uint32)(unsafe.Pointer(&mem[offWWait])),
+		wclosed: (*uint32)(unsafe.Pointer(&mem[offWClosed])),
+		rclosed: (*uint32)(unsafe.Pointer(&mem[offRClosed])),
+	}
+}
+
+func (r *ring) len() uint64 { return atomic.LoadUint64(r.tail) - atomic.LoadUint64(r.head) }
+
+func (r *ring) free() uint64 { return uint64(len(r.buf)) - r.len() }
+
+// read as much as is available into b.  Only the consumer may call it.
+func (r *ring) read(b []byte) int {
+	head := atomic.LoadUint64(r.head)
+	n := atomic.LoadUint64(r.tail) - head
+	if n > uint64(len(b)) {
+		n = uint64(len(b))
+	}
+	if n == 0 {
+		return 0
+	}
+
+	i := head & r.mask
+	k := copy(b[:n], r.buf[i:])
+	copy(b[k:n], r.buf)
+
+	atomic.StoreUint64(r.head, head+n)
+	return int(n)
+}
+
+// write as much of b as fits.  Only the producer may call it.
+func (r *ring) write(b []byte) int {
+	tail := atomic.LoadUint64(r.tail)
+	n := uint64(len(r.buf)) - (tail - atomic.LoadUint64(r.head))
+	if n > uint64(len(b)) {
+		n = uint64(len(b))
+	}
+	if n == 0 {
+		return 0
+	}
+
+	i := tail & r.mask
+	k := copy(r.buf[i:], b[:n])
+	copy(r.buf, b[k:n])
+
+	atomic.StoreUint64(r.tail, tail+n)
+	return int(n)
+}
+
+func set(p *uint32)          { atomic.StoreUint32(p, 1) }
+func isSet(p *uint32) bool   { return atomic.LoadUint32(p) == 1 }
+func consume(p *uint32) bool { return atomic.SwapUint32(p, 0) == 1 }
@@ -0,0 +1,79 @@
+// Package shm moves stream data through shared memory, for co-located
+// processes.  Connections are established over a unix socket, which carries
+// the file descriptors of a memfd segment and of eventfd counters.  Data then
+// flows through a pair of single-producer, single-consumer ring buffers mapped
+// by both processes, and the eventfds wake peers that are waiting for data or
+// space.  The unix socket remains open to detect the peer's departure.
+//
+// Shared memory is only supported on Linux.
+package shm
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+const network = "shm"
+
+func init() {
+	pipe.Register(network, func(u *url.URL) (pipe.Transport, net.Addr, error) {
+		return New(), Addr(u.Host + u.Path), nil
+	})
+}
+
+// Addr is the path of the unix socket on which connections are negotiated
+type Addr string
+
+// Network is "shm"
+func (Addr) Network() string  { return network }
+func (a Addr) String() string { return string(a) }
+
+// Config for shared memory connections.  It satisfies both generic.NetDialer
+// and generic.NetListener.  The dialer's configuration determines the size of
+// the ring buffers.
+type Config struct {
+	// RingSize is the capacity of each ring buffer, in bytes.  It is rounded up
+	// to a power of two.
+	RingSize int
+}
+
+// DefaultConfig allocates 1MiB per direction
+var DefaultConfig = Config{RingSize: 1 << 20}
+
+// Transport over shared memory
+type Transport struct{ generic.Transport }
+
+// Listen for shared memory connections on a unix socket
+func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
+	if a.Network() != network {
+		return nil, errors.Errorf("shm: invalid network %s", a.Network())
+	}
+
+	return t.Transport.Listen(c, a)
+}
+
+// Dial a shared memory listener
+func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
+	if a.Network() != network {
+		return nil, errors.Errorf("shm: invalid network %s", a.Network())
+	}
+
+	return t.Transport.Dial(c, a)
+}
+
+// New shared memory Transport
+func New(opt ...Option) (t Transport) {
+	t.Transport = generic.New()
+	OptConfig(DefaultConfig)(&t)
+
+	for _, fn := range opt {
+		fn(&t)
+	}
+
+	return t
+}
@@ -0,0 +1,338 @@
+package shm
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// magic identifies the handshake, and its version
+	magic = 0x70777368 // "pwsh"
+
+	helloSize = 12 // magic, then ring size
+	numEvents = 4
+
+	// seals prevent the peer from resizing the segment, which would fault
+	// the other process when it accesses the missing pages.
+	seals = unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_SEAL
+)
+
+// DialContext connects to the unix socket at address, and offers it a shared
+// memory segment.  The network is ignored.
+func (c Config) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	raw, err := new(net.Dialer).DialContext(ctx, "unix", address)
+	if err != nil {
+		return nil, err
+	}
+	ctl := raw.(*net.UnixConn)
+
+	if d, ok := ctx.Deadline(); ok {
+		ctl.SetDeadline(d)
+	}
+
+	conn, err := c.offer(ctl)
+	if err != nil {
+		ctl.Close()
+		return nil, errors.Wrap(err, "shm")
+	}
+
+	return conn, nil
+}
+
+func (c Config) offer(ctl *net.UnixConn) (*conn, error) {
+	size := ringSize(c.RingSize)
+
+	seg, memfd, err := newSegment(size)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(memfd)
+
+	efd, err := newEvents()
+	if err != nil {
+		unix.Munmap(seg)
+		return nil, err
+	}
+
+	var hello [helloSize]byte
+	binary.BigEndian.PutUint32(hello[:], magic)
+	binary.BigEndian.PutUint64(hello[4:], uint64(size))
+
+	rights := unix.UnixRights(append([]int{memfd}, efd...)...)
+	_, _, err = ctl.WriteMsgUnix(hello[:], rights, nil)
+	if err == nil {
+		// wait for the listener to map the segment
+		var ack [1]byte
+		_, err = ctl.Read(ack[:])
+	}
+	if err == nil {
+		err = ctl.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		unix.Munmap(seg)
+		closeFds(efd)
+		return nil, err
+	}
+
+	out, in := split(seg, size)
+	return newConn(ctl, seg, in, out, files(efd), true), nil
+}
+
+// Listen on a unix socket.  The network is ignored.
+func (c Config) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	l, err := new(net.ListenConfig).Listen(ctx, "unix", address)
+	if err != nil {
+		return nil, err
+	}
+
+	ln := &listener{
+		UnixListener: l.(*net.UnixListener),
+		addr:         Addr(address),
+		ch:           make(chan accepted),
+		die:          make(chan struct{}),
+	}
+	go ln.serve()
+	return ln, nil
+}
+
+// listener maps the segments offered by incoming connections concurrently, so
+// that a peer that stalls during the handshake does not hold up the others.
+type listener struct {
+	*net.UnixListener
+	addr Addr
+
+	ch  chan accepted
+	die chan struct{}
+	o   sync.Once
+}
+
+type accepted struct {
+	conn net.Conn
+	err  error
+}
+
+func (l *listener) Addr() net.Addr { return l.addr }
+
+func (l *listener) serve() {
+	for {
+		ctl, err := l.AcceptUnix()
+		if err != nil {
+			select {
+			case l.ch <- accepted{err: err}:
+				continue
+			case <-l.die:
+				return
+			}
+		}
+
+		go l.handshake(ctl)
+	}
+}
+
+func (l *listener) handshake(ctl *net.UnixConn) {
+	ctl.SetDeadline(time.Now().Add(generic.DefaultHandshakeTimeout))
+	conn, err := accept(ctl)
+	if err != nil {
+		// a failed handshake only concerns that peer
+		ctl.Close()
+		return
+	}
+
+	select {
+	case l.ch <- accepted{conn: conn}:
+	case <-l.die:
+		conn.Close()
+	}
+}
+
+// Accept a connection, once the segment it offers is mapped
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case a := <-l.ch:
+		return a.conn, a.err
+	case <-l.die:
+		return nil, errors.New("shm: use of closed network connection")
+	}
+}
+
+func (l *listener) Close() error {
+	l.o.Do(func() { close(l.die) })
+	return l.UnixListener.Close()
+}
+
+func accept(ctl *net.UnixConn) (*conn, error) {
+	var hello [helloSize]byte
+	oob := make([]byte, unix.CmsgSpace((numEvents+1)*4))
+
+	n, oobn, _, _, err := ctl.ReadMsgUnix(hello[:], oob)
+	if err != nil {
+		return nil, err
+	}
+
+	fds, err := parseRights(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fds) != numEvents+1 || n != helloSize || binary.BigEndian.Uint32(hello[:]) != magic {
+		closeFds(fds)
+		return nil, errors.New("shm: malformed handshake")
+	}
+
+	memfd, efd := fds[0], files(fds[1:])
+	defer unix.Close(memfd)
+
+	size := int(binary.BigEndian.Uint64(hello[4:]))
+	seg, err := mapSegment(memfd, size)
+	if err == nil {
+		_, err = ctl.Write([]byte{0})
+	}
+	if err == nil {
+		err = ctl.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		if seg != nil {
+			unix.Munmap(seg)
+		}
+		closeAll(efd)
+		return nil, err
+	}
+
+	in, out := split(seg, size)
+	return newConn(ctl, seg, in, out, efd, false), nil
+}
+
+// newSegment creates a sealed memfd large enough for two rings, and maps it
+func newSegment(size int) (seg []byte, memfd int, err error) {
+	if memfd, err = unix.MemfdCreate("pipewerks", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING); err != nil {
+		return nil, -1, errors.Wrap(err, "memfd")
+	}
+
+	if err = unix.Ftruncate(memfd, int64(segmentSize(size))); err != nil {
+		unix.Close(memfd)
+		return nil, -1, errors.Wrap(err, "truncate")
+	}
+
+	if _, err = unix.FcntlInt(uintptr(memfd), unix.F_ADD_SEALS, seals); err != nil {
+		unix.Close(memfd)
+		return nil, -1, errors.Wrap(err, "seal")
+	}
+
+	if seg, err = unix.Mmap(memfd, 0, segmentSize(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED); err != nil {
+		unix.Close(memfd)
+		return nil, -1, errors.Wrap(err, "mmap")
+	}
+
+	return seg, memfd, nil
+}
+
+// mapSegment received from a dialer, after checking that it cannot be resized
+func mapSegment(memfd, size int) ([]byte, error) {
+	if size <= 0 || size&(size-1) != 0 {
+		return nil, errors.Errorf("shm: invalid ring size %d", size)
+	}
+
+	s, err := unix.FcntlInt(uintptr(memfd), unix.F_GET_SEALS, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "get seals")
+	}
+	if s&seals != seals {
+		return nil, errors.New("shm: segment is not sealed")
+	}
+
+	var st unix.Stat_t
+	if err = unix.Fstat(memfd, &st); err != nil {
+		return nil, errors.Wrap(err, "stat")
+	}
+	if st.Size != int64(segmentSize(size)) {
+		return nil, errors.New("shm: segment size mismatch")
+	}
+
+	seg, err := unix.Mmap(memfd, 0, segmentSize(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	return seg, errors.Wrap(err, "mmap")
+}
+
+// newEvents creates non-blocking eventfds, so that waiting on them parks
+// goroutines rather than threads.
+func newEvents() ([]int, error) {
+	efd := make([]int, 0, numEvents)
+	for i := 0; i < numEvents; i++ {
+		fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+		if err != nil {
+			closeFds(efd)
+			return nil, errors.Wrap(err, "eventfd")
+		}
+
+		efd = append(efd, fd)
+	}
+
+	return efd, nil
+}
+
+// files wraps eventfds.  They MUST NOT be converted back with File.Fd, which
+// would make them blocking for both processes.
+func files(fds []int) []*os.File {
+	fs := make([]*os.File, len(fds))
+	for i, fd := range fds {
+		fs[i] = os.NewFile(uintptr(fd), "eventfd")
+	}
+
+	return fs
+}
+
+func parseRights(oob []byte) (fds []int, err error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, errors.Wrap(err, "control message")
+	}
+
+	for i := range msgs {
+		rights, err := unix.ParseUnixRights(&msgs[i])
+		if err != nil {
+			closeFds(fds)
+			return nil, errors.Wrap(err, "rights")
+		}
+
+		fds = append(fds, rights...)
+	}
+
+	return fds, nil
+}
+
+// split the segment into the dialer's outbound and inbound rings
+func split(seg []byte, size int) (d2l, l2d *ring) {
+	n := ringHeaderSize + size
+	return newRing(seg[:n]), newRing(seg[n:])
+}
+
+func segmentSize(size int) int { return 2 * (ringHeaderSize + size) }
+
+// ringSize rounds n up to a power of two, no smaller than a page
+func ringSize(n int) int {
+	size := os.Getpagesize()
+	for size < n {
+		size <<= 1
+	}
+
+	return size
+}
+
+func closeAll(fs []*os.File) {
+	for _, f := range fs {
+		f.Close()
+	}
+}
+
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		unix.Close(fd)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package shm
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+var errUnsupported = errors.New("shm: shared memory transport requires linux")
+
+// DialContext is not supported on this platform
+func (Config) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, errUnsupported
+}
+
+// Listen is not supported on this platform
+func (Config) Listen(context.Context, string, string) (net.Listener, error) {
+	return nil, errUnsupported
+}
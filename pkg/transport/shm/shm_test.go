@@ -0,0 +1,322 @@
+//go:build linux
+// +build linux
+
+package shm
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/lthibault/pipewerks/pkg/transport/inproc"
+	"github.com/lthibault/pipewerks/pkg/transport/unix"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func tempAddr(t testing.TB) (Addr, func()) {
+	dir, err := ioutil.TempDir("", "pipewerks-shm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Addr(filepath.Join(dir, "sock")), func() { os.RemoveAll(dir) }
+}
+
+func TestIntegration(t *testing.T) {
+	a, cleanup := tempAddr(t)
+	defer cleanup()
+
+	tp := New()
+	l, err := tp.Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { assert.NoError(t, l.Close()) }()
+
+	assert.Equal(t, a, l.Addr())
+	transporttest.RunListener(t, tp, l, a)
+}
+
+// pair of raw connections, bypassing the multiplexer
+func pair(t *testing.T, c Config) (d, l net.Conn, cleanup func()) {
+	a, rm := tempAddr(t)
+
+	ln, err := c.Listen(context.Background(), network, a.String())
+	if err != nil {
+		rm()
+		t.Fatal(err)
+	}
+
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		l, err = ln.Accept()
+		return
+	})
+	g.Go(func() (err error) {
+		d, err = c.DialContext(context.Background(), network, a.String())
+		return
+	})
+	if err = g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	return d, l, func() {
+		d.Close()
+		l.Close()
+		ln.Close()
+		rm()
+	}
+}
+
+func TestWrapAround(t *testing.T) {
+	d, l, cleanup := pair(t, Config{RingSize: 4096})
+	defer cleanup()
+
+	// several times the ring size, in writes that do not divide it
+	msg := make([]byte, 1<<16)
+	rand.Read(msg)
+
+	var g errgroup.Group
+	g.Go(func() error {
+		for b := msg; len(b) > 0; b = b[minInt(len(b), 3000):] {
+			if _, err := d.Write(b[:minInt(len(b), 3000)]); err != nil {
+				return err
+			}
+		}
+		return d.Close()
+	})
+
+	got, err := ioutil.ReadAll(l)
+	assert.NoError(t, err)
+	assert.NoError(t, g.Wait())
+	assert.Equal(t, msg, got)
+}
+
+func TestDeadline(t *testing.T) {
+	d, l, cleanup := pair(t, Config{RingSize: 4096})
+	defer cleanup()
+
+	t.Run("Read", func(t *testing.T) {
+		assert.NoError(t, l.SetReadDeadline(time.Now().Add(time.Millisecond*10)))
+		_, err := l.Read(make([]byte, 1))
+		if assert.Error(t, err) {
+			assert.True(t, os.IsTimeout(err))
+		}
+		assert.NoError(t, l.SetReadDeadline(time.Time{}))
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		assert.NoError(t, d.SetWriteDeadline(time.Now().Add(time.Millisecond*10)))
+		n, err := d.Write(make([]byte, 8192)) // more than fits
+		assert.Equal(t, 4096, n)
+		if assert.Error(t, err) {
+			assert.True(t, os.IsTimeout(err))
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	t.Run("Peer", func(t *testing.T) {
+		d, l, cleanup := pair(t, DefaultConfig)
+		defer cleanup()
+
+		_, err := d.Write([]byte("bye"))
+		assert.NoError(t, err)
+		assert.NoError(t, d.Close())
+
+		b, err := ioutil.ReadAll(l)
+		assert.NoError(t, err, "buffered data should be readable")
+		assert.Equal(t, "bye", string(b))
+
+		_, err = l.Write([]byte("anyone?"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Local", func(t *testing.T) {
+		_, l, cleanup := pair(t, DefaultConfig)
+		defer cleanup()
+
+		done := make(chan error)
+		go func() {
+			_, err := l.Read(make([]byte, 1))
+			done <- err
+		}()
+
+		time.Sleep(time.Millisecond * 10)
+		assert.NoError(t, l.Close())
+
+		select {
+		case err := <-done:
+			assert.Error(t, err)
+		case <-time.After(time.Second):
+			t.Error("pending read was not interrupted")
+		}
+	})
+}
+
+// TestHandshakeStall checks that a peer that never offers a segment does not hold
+// up the others.
+func TestHandshakeStall(t *testing.T) {
+	a, rm := tempAddr(t)
+	defer rm()
+
+	ln, err := DefaultConfig.Listen(context.Background(), network, a.String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+
+	stalled, err := net.Dial("unix", a.String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stalled.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	d, err := DefaultConfig.DialContext(context.Background(), network, a.String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer d.Close()
+
+	select {
+	case l := <-accepted:
+		l.Close()
+	case <-time.After(time.Second):
+		t.Error("accept blocked by a stalled handshake")
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type benchTransport struct {
+	name string
+	tp   pipe.Transport
+	addr func(b *testing.B) (net.Addr, func())
+}
+
+func benchTransports() []benchTransport {
+	sock := func(wrap func(string) net.Addr) func(b *testing.B) (net.Addr, func()) {
+		return func(b *testing.B) (net.Addr, func()) {
+			a, cleanup := tempAddr(b)
+			return wrap(a.String()), cleanup
+		}
+	}
+
+	return []benchTransport{
+		{"shm", New(), sock(func(s string) net.Addr { return Addr(s) })},
+		{"unix", unix.New(), sock(func(s string) net.Addr {
+			return &net.UnixAddr{Net: "unix", Name: s}
+		})},
+		{"inproc", inproc.New(), func(*testing.B) (net.Addr, func()) {
+			return inproc.Addr("/bench"), func() {}
+		}},
+	}
+}
+
+// streams connects a pair of streams over the transport
+func streams(b *testing.B, bt benchTransport) (ds, ls pipe.Stream, cleanup func()) {
+	a, rm := bt.addr(b)
+
+	l, err := bt.tp.Listen(context.Background(), a)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var dc, lc pipe.Conn
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		if lc, err = l.Accept(); err == nil {
+			ls, err = lc.AcceptStream()
+		}
+		if err == nil {
+			_, err = io.ReadFull(ls, make([]byte, 1))
+		}
+		return
+	})
+	g.Go(func() (err error) {
+		if dc, err = bt.tp.Dial(context.Background(), a); err == nil {
+			ds, err = dc.OpenStream()
+		}
+		if err == nil {
+			_, err = ds.Write([]byte{0}) // announce the stream
+		}
+		return
+	})
+	if err = g.Wait(); err != nil {
+		b.Fatal(err)
+	}
+
+	return ds, ls, func() {
+		dc.Close()
+		lc.Close()
+		l.Close()
+		rm()
+	}
+}
+
+func BenchmarkThroughput(b *testing.B) {
+	for _, bt := range benchTransports() {
+		b.Run(bt.name, func(b *testing.B) {
+			ds, ls, cleanup := streams(b, bt)
+			defer cleanup()
+
+			go io.Copy(ioutil.Discard, ls)
+
+			snd := make([]byte, 32*1024)
+			b.SetBytes(int64(len(snd)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := ds.Write(snd); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLatency(b *testing.B) {
+	for _, bt := range benchTransports() {
+		b.Run(bt.name, func(b *testing.B) {
+			ds, ls, cleanup := streams(b, bt)
+			defer cleanup()
+
+			go io.Copy(ls, ls) // echo
+
+			buf := make([]byte, 1)
+			b.ResetTimer()
+
+			// round trips
+			for i := 0; i < b.N; i++ {
+				if _, err := ds.Write(buf); err != nil {
+					b.Fatal(err)
+				}
+
+				if _, err := io.ReadFull(ds, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package ssh
+
+import (
+	"io"
+	"net"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// channelType is OpenSSH's extension for forwarding to unix sockets
+const channelType = "direct-streamlocal@openssh.com"
+
+// streamLocal is the payload of a direct-streamlocal channel request
+type streamLocal struct {
+	SocketPath string
+	Reserved0  string
+	Reserved1  uint32
+}
+
+// channelConn adapts an SSH channel to net.Conn.  Channels do not support
+// deadlines, so the channel is bridged to a synchronous in-memory pipe, which
+// does.
+type channelConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+// newChannelConn bridges the channel.  If done is non-nil, it is called after
+// the channel is closed.
+func newChannelConn(ch gossh.Channel, conn gossh.Conn, done func()) *channelConn {
+	p, q := net.Pipe()
+
+	go func() {
+		io.Copy(q, ch)
+		q.Close()
+	}()
+
+	go func() {
+		io.Copy(ch, q)
+		ch.Close()
+		if done != nil {
+			done()
+		}
+	}()
+
+	return &channelConn{Conn: p, local: conn.LocalAddr(), remote: conn.RemoteAddr()}
+}
+
+func (c *channelConn) LocalAddr() net.Addr  { return c.local }
+func (c *channelConn) RemoteAddr() net.Addr { return c.remote }
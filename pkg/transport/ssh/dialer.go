@@ -0,0 +1,83 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Dialer is a generic.NetDialer that establishes a new SSH connection, and
+// opens a direct-streamlocal channel on it.  Addresses are ssh:// URLs.  The
+// SSH connection is closed along with the channel.
+type Dialer struct {
+	// Config of the SSH client
+	Config *gossh.ClientConfig
+
+	// Forward dials the SSH server.  Defaults to a net.Dialer.
+	Forward generic.NetDialer
+}
+
+// DialContext connects to the SSH server and opens a channel to the URL path
+func (d Dialer) DialContext(c context.Context, network, address string) (net.Conn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "ssh")
+	}
+
+	cfg := *d.Config
+	if u.User != nil {
+		cfg.User = u.User.Username()
+	}
+
+	fwd := d.Forward
+	if fwd == nil {
+		fwd = new(net.Dialer)
+	}
+
+	raw, err := fwd.DialContext(c, "tcp", u.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial")
+	}
+
+	// the handshake cannot be canceled, so it is bounded by the context's
+	// deadline instead
+	if dl, ok := c.Deadline(); ok {
+		raw.SetDeadline(dl)
+	}
+
+	sc, chans, reqs, err := gossh.NewClientConn(raw, u.Host, &cfg)
+	if err != nil {
+		raw.Close()
+		return nil, errors.Wrap(err, "handshake")
+	}
+	go gossh.DiscardRequests(reqs)
+	go rejectAll(chans)
+
+	ch, creqs, err := sc.OpenChannel(channelType, gossh.Marshal(streamLocal{
+		SocketPath: u.Path,
+	}))
+	if err != nil {
+		sc.Close()
+		return nil, errors.Wrap(err, "open channel")
+	}
+	go gossh.DiscardRequests(creqs)
+
+	if err = raw.SetDeadline(time.Time{}); err != nil {
+		sc.Close()
+		return nil, errors.Wrap(err, "clear deadline")
+	}
+
+	return newChannelConn(ch, sc, func() { sc.Close() }), nil
+}
+
+// rejectAll rejects channels opened by the server
+func rejectAll(chans <-chan gossh.NewChannel) {
+	for nc := range chans {
+		nc.Reject(gossh.Prohibited, "channels are opened by the client")
+	}
+}
@@ -0,0 +1,45 @@
+package ssh
+
+import (
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Option for SSH transport
+type Option func(*Transport) (prev Option)
+
+// OptClientConfig sets the configuration used to dial SSH servers.  It must
+// specify how the server's host key is verified, and how to authenticate.
+func OptClientConfig(c *gossh.ClientConfig) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptClientConfig(t.client)
+		t.client = c
+		return
+	}
+}
+
+// OptServerConfig sets the configuration of the embedded SSH server used by
+// listeners.  It must have at least one host key.
+func OptServerConfig(c *gossh.ServerConfig) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptServerConfig(t.server)
+		t.server = c
+		return
+	}
+}
+
+// OptForward sets the dialer used to reach SSH servers, e.g. a generic.SOCKS5.
+func OptForward(d generic.NetDialer) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptForward(t.fwd)
+		t.fwd = d
+		return
+	}
+}
+
+// OptGeneric sets an option on the underlying generic transport
+func OptGeneric(opt generic.Option) Option {
+	return func(t *Transport) Option {
+		return OptGeneric(opt(&t.Transport))
+	}
+}
@@ -0,0 +1,183 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const acceptBacklog = 128
+
+// Server is a generic.NetListener that runs an embedded SSH server.  Each
+// direct-streamlocal channel for the listener's path is accepted as a
+// connection, so that a single SSH connection may carry several of them.  All
+// other channels are rejected.
+type Server struct {
+	// Config of the SSH server.  It must have at least one host key.
+	Config *gossh.ServerConfig
+}
+
+// Listen for SSH connections on the host of an ssh:// URL.  If the URL has a
+// path, channels to other socket paths are rejected.
+func (s Server) Listen(c context.Context, network, address string) (net.Listener, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "ssh")
+	}
+
+	ln, err := new(net.ListenConfig).Listen(c, "tcp", u.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen")
+	}
+
+	// report the bound address, in case the port was chosen by the OS
+	bound := *u
+	bound.User = nil
+	bound.Host = ln.Addr().String()
+
+	l := &listener{
+		cfg:    s.Config,
+		ln:     ln,
+		addr:   Addr{URL: &bound},
+		conns:  make(map[*gossh.ServerConn]struct{}),
+		accept: make(chan net.Conn, acceptBacklog),
+		die:    make(chan struct{}),
+	}
+	go l.serve()
+
+	return l, nil
+}
+
+type listener struct {
+	cfg  *gossh.ServerConfig
+	ln   net.Listener
+	addr Addr
+
+	mu    sync.Mutex
+	conns map[*gossh.ServerConn]struct{}
+
+	accept  chan net.Conn
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.die:
+		return nil, errors.New("ssh: listener closed")
+	}
+}
+
+func (l *listener) Addr() net.Addr { return l.addr }
+
+// Close the listener, along with the SSH connections it accepted
+func (l *listener) Close() (err error) {
+	l.dieOnce.Do(func() {
+		close(l.die)
+		err = l.ln.Close()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for sc := range l.conns {
+			sc.Close()
+		}
+	})
+	return
+}
+
+func (l *listener) serve() {
+	defer l.Close()
+
+	for {
+		raw, err := l.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go l.handshake(raw)
+	}
+}
+
+func (l *listener) handshake(raw net.Conn) {
+	raw.SetDeadline(time.Now().Add(generic.DefaultHandshakeTimeout))
+	sc, chans, reqs, err := gossh.NewServerConn(raw, l.cfg)
+	if err != nil {
+		raw.Close()
+		return
+	}
+	raw.SetDeadline(time.Time{})
+	go gossh.DiscardRequests(reqs)
+
+	if !l.track(sc) {
+		sc.Close()
+		return
+	}
+	defer l.untrack(sc)
+
+	for nc := range chans {
+		l.handleChannel(sc, nc)
+	}
+}
+
+func (l *listener) handleChannel(sc *gossh.ServerConn, nc gossh.NewChannel) {
+	if nc.ChannelType() != channelType {
+		nc.Reject(gossh.UnknownChannelType, "unsupported channel type")
+		return
+	}
+
+	var msg streamLocal
+	if err := gossh.Unmarshal(nc.ExtraData(), &msg); err != nil {
+		nc.Reject(gossh.ConnectionFailed, "malformed request")
+		return
+	}
+
+	if l.addr.Path != "" && msg.SocketPath != l.addr.Path {
+		nc.Reject(gossh.ConnectionFailed, "no such socket")
+		return
+	}
+
+	if len(l.accept) == cap(l.accept) {
+		nc.Reject(gossh.ResourceShortage, "backlog full")
+		return
+	}
+
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+
+	select {
+	case l.accept <- newChannelConn(ch, sc, nil):
+	case <-l.die:
+		ch.Close()
+	}
+}
+
+// track the connection, unless the listener is closed
+func (l *listener) track(sc *gossh.ServerConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.die:
+		return false
+	default:
+		l.conns[sc] = struct{}{}
+		return true
+	}
+}
+
+func (l *listener) untrack(sc *gossh.ServerConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.conns, sc)
+}
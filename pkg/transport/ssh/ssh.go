@@ -0,0 +1,87 @@
+// Package ssh multiplexes streams over an SSH connection.  Each connection is
+// carried by a single direct-streamlocal@openssh.com channel, which OpenSSH
+// servers forward to a unix socket on the remote host.  A pipewerks unix
+// listener bound to that socket can therefore be reached through any OpenSSH
+// server.  Listeners run an embedded SSH server that accepts such channels.
+package ssh
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Addr is an SSH URL of the form ssh://[user@]host:port/path/to/socket.  The
+// path names the unix socket that connections are forwarded to.
+type Addr struct{ *url.URL }
+
+// ParseAddr parses an ssh:// URL
+func ParseAddr(rawurl string) (Addr, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Addr{}, errors.Wrap(err, "ssh")
+	}
+
+	return Addr{URL: u}, nil
+}
+
+// Network is "ssh"
+func (a Addr) Network() string { return "ssh" }
+
+func (a Addr) String() string { return a.URL.String() }
+
+func checkNetwork(a net.Addr) bool { return a.Network() == "ssh" }
+
+// Transport over SSH
+type Transport struct {
+	generic.Transport
+
+	client *gossh.ClientConfig
+	server *gossh.ServerConfig
+	fwd    generic.NetDialer
+}
+
+// Listen starts an SSH server on the address' host, which accepts channels for
+// the address' path.  It requires a server configuration with a host key.
+func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("ssh: invalid network %s", a.Network())
+	}
+
+	if t.server == nil {
+		return nil, errors.New("ssh: listening requires a server configuration")
+	}
+
+	t.Transport.NetListener = Server{Config: t.server}
+	return t.Transport.Listen(c, a)
+}
+
+// Dial an SSH server and open a channel to the address' path.  The user
+// specified in the address takes precedence over the client configuration's.
+func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("ssh: invalid network %s", a.Network())
+	}
+
+	if t.client == nil {
+		return nil, errors.New("ssh: dialing requires a client configuration")
+	}
+
+	t.Transport.NetDialer = Dialer{Config: t.client, Forward: t.fwd}
+	return t.Transport.Dial(c, a)
+}
+
+// New SSH Transport
+func New(opt ...Option) (t Transport) {
+	t.Transport = generic.New()
+	for _, fn := range opt {
+		fn(&t)
+	}
+
+	return t
+}
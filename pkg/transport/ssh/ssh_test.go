@@ -0,0 +1,133 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) gossh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// configs for a server that only admits the client's key, and a client that
+// only trusts the server's host key
+func newConfigs(t *testing.T) (*gossh.ClientConfig, *gossh.ServerConfig) {
+	host, user := newSigner(t), newSigner(t)
+
+	sc := &gossh.ServerConfig{
+		PublicKeyCallback: func(m gossh.ConnMetadata, k gossh.PublicKey) (*gossh.Permissions, error) {
+			if !bytes.Equal(k.Marshal(), user.PublicKey().Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	sc.AddHostKey(host)
+
+	cc := &gossh.ClientConfig{
+		User:            "pipewerks",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(user)},
+		HostKeyCallback: gossh.FixedHostKey(host.PublicKey()),
+	}
+
+	return cc, sc
+}
+
+func TestIntegration(t *testing.T) {
+	cc, sc := newConfigs(t)
+	tp := New(OptClientConfig(cc), OptServerConfig(sc))
+
+	a, err := ParseAddr("ssh://127.0.0.1:0/tmp/pipewerks.sock")
+	assert.NoError(t, err)
+
+	l, err := tp.Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { assert.NoError(t, l.Close()) }()
+
+	assert.Equal(t, "ssh", l.Addr().Network())
+	assert.NotContains(t, l.Addr().String(), ":0/")
+
+	transporttest.RunListener(t, tp, l, l.Addr())
+}
+
+func TestReject(t *testing.T) {
+	cc, sc := newConfigs(t)
+	tp := New(OptClientConfig(cc), OptServerConfig(sc))
+
+	a, err := ParseAddr("ssh://127.0.0.1:0/tmp/pipewerks.sock")
+	assert.NoError(t, err)
+
+	l, err := tp.Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { assert.NoError(t, l.Close()) }()
+
+	c, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	t.Run("Path", func(t *testing.T) {
+		other := *l.Addr().(Addr).URL
+		other.Path = "/tmp/other.sock"
+
+		_, err := tp.Dial(c, Addr{URL: &other})
+		assert.Error(t, err)
+	})
+
+	t.Run("HostKey", func(t *testing.T) {
+		untrusting, _ := newConfigs(t)
+		untrusting.Auth = cc.Auth
+
+		_, err := New(OptClientConfig(untrusting)).Dial(c, l.Addr())
+		assert.Error(t, err)
+	})
+
+	t.Run("Auth", func(t *testing.T) {
+		stranger, _ := newConfigs(t)
+		stranger.HostKeyCallback = cc.HostKeyCallback
+
+		_, err := New(OptClientConfig(stranger)).Dial(c, l.Addr())
+		assert.Error(t, err)
+	})
+}
+
+func TestCheckNetwork(t *testing.T) {
+	_, err := New().Dial(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+
+	_, err = New().Listen(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+}
+
+func TestMissingConfig(t *testing.T) {
+	a, err := ParseAddr("ssh://127.0.0.1:0/tmp/pipewerks.sock")
+	assert.NoError(t, err)
+
+	_, err = New().Dial(context.Background(), a)
+	assert.Error(t, err)
+
+	_, err = New().Listen(context.Background(), a)
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package stdio
+
+import (
+	"net"
+	"os"
+	"time"
+)
+
+// fileConn joins a pair of files into a net.Conn
+type fileConn struct {
+	r, w          *os.File
+	local, remote net.Addr
+}
+
+func (c *fileConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c *fileConn) Write(b []byte) (int, error) { return c.w.Write(b) }
+
+func (c *fileConn) Close() error {
+	werr := c.w.Close()
+	if err := c.r.Close(); err != nil {
+		return err
+	}
+	return werr
+}
+
+func (c *fileConn) LocalAddr() net.Addr  { return c.local }
+func (c *fileConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *fileConn) SetDeadline(t time.Time) error {
+	if err := c.r.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.w.SetWriteDeadline(t)
+}
+
+func (c *fileConn) SetReadDeadline(t time.Time) error  { return c.r.SetReadDeadline(t) }
+func (c *fileConn) SetWriteDeadline(t time.Time) error { return c.w.SetWriteDeadline(t) }
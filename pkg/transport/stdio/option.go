@@ -0,0 +1,13 @@
+package stdio
+
+import "github.com/lthibault/pipewerks/pkg/transport/generic"
+
+// Option for stdio transport
+type Option func(*Transport) (prev Option)
+
+// OptGeneric sets an option on the underlying generic transport
+func OptGeneric(opt generic.Option) Option {
+	return func(t *Transport) Option {
+		return OptGeneric(opt(&t.Transport))
+	}
+}
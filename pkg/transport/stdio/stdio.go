@@ -0,0 +1,244 @@
+// Package stdio multiplexes streams over the standard input and output of a
+// child process, in the manner of language servers.
+package stdio
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+// Addr describes a command, in the manner of exec.Cmd
+type Addr struct {
+	// Path of the command to run
+	Path string
+
+	// Args holds command line arguments, including the command as Args[0]
+	Args []string
+
+	// Env specifies the environment of the process.  If nil, the current
+	// process' environment is used.
+	Env []string
+
+	// Dir specifies the working directory of the command
+	Dir string
+
+	// Stderr receives the standard error of the process.  If nil, it is
+	// discarded.
+	Stderr io.Writer
+}
+
+// Command returns an Addr for the named program, as exec.Command does
+func Command(name string, arg ...string) *Addr {
+	cmd := exec.Command(name, arg...)
+	return &Addr{Path: cmd.Path, Args: cmd.Args}
+}
+
+// Network is "stdio"
+func (a *Addr) Network() string { return "stdio" }
+
+func (a *Addr) String() string {
+	if len(a.Args) == 0 {
+		return a.Path
+	}
+
+	return strings.Join(a.Args, " ")
+}
+
+func (a *Addr) cmd() *exec.Cmd {
+	return &exec.Cmd{
+		Path:   a.Path,
+		Args:   a.Args,
+		Env:    a.Env,
+		Dir:    a.Dir,
+		Stderr: a.Stderr,
+	}
+}
+
+// Conn to a child process.  Its context expires when the process exits.
+type Conn struct {
+	pipe.Conn
+	c      context.Context
+	cancel func()
+
+	proc *os.Process
+	done chan struct{}
+	err  error
+}
+
+// Context expires when the connection is closed or the process exits
+func (c *Conn) Context() context.Context { return c.c }
+
+// Process returns the child process
+func (c *Conn) Process() *os.Process { return c.proc }
+
+// Wait for the process to exit, and return its exit status as exec.Cmd.Wait
+// does.
+func (c *Conn) Wait() error {
+	<-c.done
+	return c.err
+}
+
+// Transport over the standard I/O of a child process
+type Transport struct{ generic.Transport }
+
+// Dial starts the command described by the address, and connects to it over
+// its standard input and output.  The process is not killed when the context
+// expires, but closing the connection closes its standard input.
+func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
+	addr, ok := a.(*Addr)
+	if !ok {
+		return nil, errors.Errorf("stdio: invalid address type %T", a)
+	}
+
+	cmd := addr.cmd()
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "stdin")
+	}
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, errors.Wrap(err, "stdout")
+	}
+
+	cmd.Stdin, cmd.Stdout = inR, outW
+	err = cmd.Start()
+	inR.Close() // the child holds its own copies
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, errors.Wrap(err, "start")
+	}
+
+	raw := &fileConn{r: outR, w: inW, local: self(), remote: addr}
+	conn := &Conn{proc: cmd.Process, done: make(chan struct{})}
+	go func() {
+		conn.err = cmd.Wait()
+		close(conn.done)
+		raw.Close()
+	}()
+
+	t.Transport.NetDialer = oneShot{raw}
+	pc, err := t.Transport.Dial(c, a)
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+
+	conn.Conn = pc
+	conn.c, conn.cancel = context.WithCancel(pc.Context())
+	go func() {
+		select {
+		case <-conn.done:
+			conn.cancel()
+		case <-conn.c.Done():
+		}
+	}()
+
+	return conn, nil
+}
+
+// Listen on the standard input and output of the current process.  Exactly one
+// connection is accepted.  The address is ignored.
+//
+// SIGPIPE is delivered to a channel that is never read from then on, as the
+// parent may hang up while the multiplexer is still writing, which would
+// otherwise kill the process.  Writes fail with EPIPE instead.  Unlike
+// signal.Ignore, this is not inherited by processes that the caller executes.
+//
+// Standard input and output do not support deadlines, so security and
+// multiplexer negotiation handshakes are not bounded by a timeout.
+func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGPIPE)
+
+	t.Transport.NetListener = newListener(&fileConn{
+		r:      os.Stdin,
+		w:      os.Stdout,
+		local:  self(),
+		remote: &Addr{Path: "parent"},
+	})
+
+	return t.Transport.Listen(c, self())
+}
+
+// Listen on the standard input and output of the current process, using a
+// Transport with the specified options.
+func Listen(c context.Context, opt ...Option) (pipe.Listener, error) {
+	return New(opt...).Listen(c, self())
+}
+
+func self() *Addr {
+	path, _ := os.Executable()
+	return &Addr{Path: path, Args: os.Args}
+}
+
+// oneShot is a NetDialer that returns a connection that has already been
+// established.
+type oneShot struct{ net.Conn }
+
+func (d oneShot) DialContext(context.Context, string, string) (net.Conn, error) {
+	return d.Conn, nil
+}
+
+// listener accepts a single connection
+type listener struct {
+	conn net.Conn
+	once sync.Once
+	ch   chan net.Conn
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+func newListener(conn net.Conn) *listener {
+	l := &listener{conn: conn, ch: make(chan net.Conn, 1), die: make(chan struct{})}
+	l.ch <- conn
+	return l
+}
+
+func (l *listener) Listen(context.Context, string, string) (net.Listener, error) {
+	return l, nil
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.ch:
+		return conn, nil
+	case <-l.die:
+		return nil, errors.New("stdio: listener closed")
+	}
+}
+
+func (l *listener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+// Close the listener.  The accepted connection is unaffected.
+func (l *listener) Close() error {
+	l.dieOnce.Do(func() { close(l.die) })
+	return nil
+}
+
+// New stdio Transport
+func New(opt ...Option) (t Transport) {
+	t.Transport = generic.New()
+
+	for _, fn := range opt {
+		fn(&t)
+	}
+
+	return t
+}
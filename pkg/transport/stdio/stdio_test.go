@@ -0,0 +1,138 @@
+package stdio
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/stretchr/testify/assert"
+)
+
+const helperEnv = "PIPEWERKS_STDIO_HELPER"
+
+// TestHelperProcess is run as a child process by the other tests
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv(helperEnv)
+	if mode == "" {
+		return
+	}
+
+	var opt []Option
+	if mode == "secure" {
+		opt = secure()
+	}
+
+	l, err := Listen(context.Background(), opt...)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		os.Exit(2)
+	}
+
+	if mode == "exit" {
+		os.Exit(3)
+	}
+
+	s, err := conn.AcceptStream()
+	if err != nil {
+		os.Exit(2)
+	}
+
+	io.Copy(s, s)
+	s.Close()
+	conn.Close()
+	os.Exit(0)
+}
+
+// secure options for both ends of a connection, which perform handshakes that
+// would otherwise be bounded by deadlines
+func secure() []Option {
+	key, err := generic.NewNoiseKeypair()
+	if err != nil {
+		panic(err)
+	}
+
+	return []Option{
+		OptGeneric(generic.OptNoise(generic.NoiseConfig{StaticKeypair: key})),
+		OptGeneric(generic.OptNegotiate(generic.MuxProtocol{
+			ID:         generic.YamuxID,
+			MuxAdapter: generic.MuxConfig{},
+		})),
+	}
+}
+
+func helper(mode string) *Addr {
+	a := Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	a.Env = append(os.Environ(), helperEnv+"="+mode)
+	a.Stderr = os.Stderr
+	return a
+}
+
+func TestEcho(t *testing.T) {
+	t.Run("Plain", func(t *testing.T) { testEcho(t, "echo") })
+	t.Run("Secure", func(t *testing.T) { testEcho(t, "secure", secure()...) })
+}
+
+func testEcho(t *testing.T, mode string, opt ...Option) {
+	c, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	conn, err := New(opt...).Dial(c, helper(mode))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	s, err := conn.OpenStream()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = io.WriteString(s, "hello, child")
+	assert.NoError(t, err)
+	assert.NoError(t, s.CloseWrite())
+
+	buf := make([]byte, len("hello, child"))
+	_, err = io.ReadFull(s, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello, child", string(buf))
+	assert.NoError(t, s.Close())
+
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, conn.(*Conn).Wait())
+}
+
+func TestChildExit(t *testing.T) {
+	c, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	conn, err := New().Dial(c, helper("exit"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	select {
+	case <-conn.Context().Done():
+	case <-c.Done():
+		t.Fatal("context did not expire when the child exited")
+	}
+
+	err = conn.(*Conn).Wait()
+	if assert.IsType(t, (*exec.ExitError)(nil), err) {
+		assert.Equal(t, 3, err.(*exec.ExitError).ExitCode())
+	}
+}
+
+func TestInvalidAddr(t *testing.T) {
+	_, err := New().Dial(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+}
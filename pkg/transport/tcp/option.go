@@ -1,7 +1,9 @@
 package tcp
 
 import (
+	"crypto/tls"
 	"net"
+	"time"
 
 	"github.com/lthibault/pipewerks/pkg/transport/generic"
 )
@@ -9,20 +11,76 @@ import (
 // Option for TCP transport
 type Option func(*Transport) (prev Option)
 
-// OptListener sets the ListenConfig
-func OptListener(l *net.ListenConfig) Option {
+// OptListener sets the listener, e.g. a net.ListenConfig, a generic.Activation
+// or a handoff.Upgrader
+func OptListener(l generic.NetListener) Option { return OptGeneric(generic.OptListener(l)) }
+
+// OptDialer sets the dialer
+func OptDialer(d *net.Dialer) Option { return OptGeneric(generic.OptDialer(d)) }
+
+// OptSOCKS5 dials connections through a SOCKS5 proxy
+func OptSOCKS5(s generic.SOCKS5) Option { return OptGeneric(generic.OptDialer(s)) }
+
+// OptTLS secures connections with TLS before they are multiplexed
+func OptTLS(c *tls.Config) Option { return OptGeneric(generic.OptTLS(c)) }
+
+// OptReusePort sets SO_REUSEPORT, so that several listeners may bind the same
+// address.
+func OptReusePort(reuse bool) Option {
 	return func(t *Transport) (prev Option) {
-		prev = OptListener(t.Transport.NetListener.(*net.ListenConfig))
-		OptGeneric(generic.OptListener(l))(t)
+		prev = OptReusePort(t.so.reusePort)
+		t.so.reusePort = reuse
 		return
 	}
 }
 
-// OptDialer sets the dialer
-func OptDialer(d *net.Dialer) Option {
+// OptNoDelay sets TCP_NODELAY, which disables Nagle's algorithm.  It is enabled
+// by default.
+func OptNoDelay(noDelay bool) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptNoDelay(!t.delay)
+		t.delay = !noDelay
+		return
+	}
+}
+
+// OptKeepAlive configures keep-alive probes, instead of the standard library's
+// defaults.
+func OptKeepAlive(ka KeepAlive) Option { return optKeepAlive(&ka) }
+
+func optKeepAlive(ka *KeepAlive) Option {
+	return func(t *Transport) (prev Option) {
+		prev = optKeepAlive(t.so.keepAlive)
+		t.so.keepAlive = ka
+		return
+	}
+}
+
+// OptUserTimeout sets TCP_USER_TIMEOUT, the time for which transmitted data may
+// remain unacknowledged before the connection is dropped.
+func OptUserTimeout(d time.Duration) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptUserTimeout(t.so.userTimeout)
+		t.so.userTimeout = d
+		return
+	}
+}
+
+// OptBuffers sets the size of the socket's send and receive buffers, in bytes.
+// Zero leaves the system default in place.
+func OptBuffers(send, recv int) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptBuffers(t.so.sndbuf, t.so.rcvbuf)
+		t.so.sndbuf, t.so.rcvbuf = send, recv
+		return
+	}
+}
+
+// OptTOS sets the type of service (IP_TOS), or traffic class for IPv6 sockets.
+func OptTOS(tos int) Option {
 	return func(t *Transport) (prev Option) {
-		prev = OptDialer(t.Transport.NetDialer.(*net.Dialer))
-		OptGeneric(generic.OptDialer(d))(t)
+		prev = OptTOS(t.so.tos)
+		t.so.tos = tos
 		return
 	}
 }
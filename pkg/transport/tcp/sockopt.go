@@ -0,0 +1,156 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+// KeepAlive configures TCP keep-alive probes.  Zero durations and counts leave
+// the system defaults in place.
+type KeepAlive struct {
+	// Enable keep-alive probes.  If false, they are disabled.
+	Enable bool
+
+	// Idle time before the first probe is sent
+	Idle time.Duration
+
+	// Interval between unacknowledged probes
+	Interval time.Duration
+
+	// Count of unacknowledged probes after which the connection is dropped
+	Count int
+}
+
+// sockopts are set on sockets before they are bound.  Zero values leave the
+// system defaults in place.
+type sockopts struct {
+	reusePort   bool
+	keepAlive   *KeepAlive // nil keeps the standard library's default
+	userTimeout time.Duration
+	sndbuf      int
+	rcvbuf      int
+	tos         int
+}
+
+func (o sockopts) isSet() bool { return o != sockopts{} }
+
+// control composes the options with a net.ListenConfig or net.Dialer control
+// function, which is called first.
+func (o sockopts) control(prev func(string, string, syscall.RawConn) error) func(string, string, syscall.RawConn) error {
+	return func(network, address string, rc syscall.RawConn) error {
+		if prev != nil {
+			if err := prev(network, address, rc); err != nil {
+				return err
+			}
+		}
+
+		var serr error
+		if err := rc.Control(func(fd uintptr) { serr = o.apply(int(fd)) }); err != nil {
+			return err
+		}
+
+		return serr
+	}
+}
+
+// listener applies the options to a net.ListenConfig.  Other listeners cannot
+// be configured.
+func (o sockopts) listener(l generic.NetListener) (generic.NetListener, error) {
+	if !o.isSet() {
+		return l, nil
+	}
+
+	lc, ok := l.(*net.ListenConfig)
+	if !ok {
+		return nil, errors.Errorf("tcp: socket options cannot be set on %T", l)
+	}
+
+	cfg := *lc
+	cfg.Control = o.control(cfg.Control)
+	if o.keepAlive != nil {
+		cfg.KeepAlive = -1 // set by the control function
+	}
+
+	return &cfg, nil
+}
+
+// dialer applies the options to a net.Dialer.  Other dialers cannot be
+// configured.
+func (o sockopts) dialer(d generic.NetDialer) (generic.NetDialer, error) {
+	if !o.isSet() {
+		return d, nil
+	}
+
+	nd, ok := d.(*net.Dialer)
+	if !ok {
+		return nil, errors.Errorf("tcp: socket options cannot be set on %T", d)
+	}
+
+	cfg := *nd
+	cfg.Control = o.control(cfg.Control)
+	if o.keepAlive != nil {
+		cfg.KeepAlive = -1
+	}
+
+	return &cfg, nil
+}
+
+// The standard library enables TCP_NODELAY once connections are established,
+// so Nagle's algorithm is re-enabled on each connection.
+
+type delayDialer struct{ generic.NetDialer }
+
+func (d delayDialer) DialContext(c context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.NetDialer.DialContext(c, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = setDelay(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+type delayListener struct{ generic.NetListener }
+
+func (d delayListener) Listen(c context.Context, network, address string) (net.Listener, error) {
+	l, err := d.NetListener.Listen(c, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return delayAcceptor{l}, nil
+}
+
+type delayAcceptor struct{ net.Listener }
+
+func (l delayAcceptor) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = setDelay(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func setDelay(conn net.Conn) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil // e.g. proxied
+	}
+
+	return errors.Wrap(tc.SetNoDelay(false), "tcp: set nodelay")
+}
@@ -0,0 +1,96 @@
+package tcp
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func (o sockopts) apply(fd int) error {
+	return errors.Wrap(o.set(fd), "tcp: setsockopt")
+}
+
+func (o sockopts) set(fd int) error {
+	if o.reusePort {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return err
+		}
+	}
+
+	if ka := o.keepAlive; ka != nil {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, boolint(ka.Enable)); err != nil {
+			return err
+		}
+
+		if ka.Idle > 0 {
+			if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE, seconds(ka.Idle)); err != nil {
+				return err
+			}
+		}
+
+		if ka.Interval > 0 {
+			if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, seconds(ka.Interval)); err != nil {
+				return err
+			}
+		}
+
+		if ka.Count > 0 {
+			if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, ka.Count); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.userTimeout > 0 {
+		ms := int(o.userTimeout.Nanoseconds() / 1e6)
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, ms); err != nil {
+			return err
+		}
+	}
+
+	if o.sndbuf > 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF, o.sndbuf); err != nil {
+			return err
+		}
+	}
+
+	if o.rcvbuf > 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, o.rcvbuf); err != nil {
+			return err
+		}
+	}
+
+	if o.tos > 0 {
+		return setTOS(fd, o.tos)
+	}
+
+	return nil
+}
+
+// setTOS sets the traffic class of both IPv4 and IPv6 sockets
+func setTOS(fd int, tos int) error {
+	domain, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_DOMAIN)
+	if err != nil {
+		return err
+	}
+
+	if domain == unix.AF_INET6 {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos)
+	}
+
+	return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, tos)
+}
+
+func boolint(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// seconds rounded up, as the kernel's resolution is one second
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
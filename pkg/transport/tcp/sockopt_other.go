@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package tcp
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+func (o sockopts) apply(fd int) error {
+	return errors.Errorf("tcp: socket options not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,136 @@
+//go:build linux
+// +build linux
+
+package tcp
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// sockets returns the accepted and dialed ends of a connection, along with the
+// listener.
+func sockets(t *testing.T, tp Transport) (l net.Listener, accepted, dialed net.Conn) {
+	nl, err := tp.netListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := tp.netDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := context.Background()
+	if l, err = nl.Listen(c, "tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		assert.NoError(t, err)
+		ch <- conn
+	}()
+
+	if dialed, err = nd.DialContext(c, "tcp", l.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	return l, <-ch, dialed
+}
+
+func getsockopt(t *testing.T, v interface{}, level, opt int) (n int) {
+	rc, err := v.(interface {
+		SyscallConn() (syscall.RawConn, error)
+	}).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc.Control(func(fd uintptr) {
+		n, err = unix.GetsockoptInt(int(fd), level, opt)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestSockopts(t *testing.T) {
+	tp := New(
+		OptKeepAlive(KeepAlive{Enable: true, Idle: 30 * time.Second, Interval: 5 * time.Second, Count: 4}),
+		OptUserTimeout(10*time.Second),
+		OptBuffers(1<<16, 1<<17),
+		OptTOS(0x10),
+		OptNoDelay(false))
+
+	l, accepted, dialed := sockets(t, tp)
+	defer l.Close()
+	defer accepted.Close()
+	defer dialed.Close()
+
+	for _, conn := range []net.Conn{accepted, dialed} {
+		assert.Equal(t, 1, getsockopt(t, conn, unix.SOL_SOCKET, unix.SO_KEEPALIVE))
+		assert.Equal(t, 30, getsockopt(t, conn, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE))
+		assert.Equal(t, 5, getsockopt(t, conn, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL))
+		assert.Equal(t, 4, getsockopt(t, conn, unix.IPPROTO_TCP, unix.TCP_KEEPCNT))
+		assert.Equal(t, 10000, getsockopt(t, conn, unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT))
+		assert.Equal(t, 0x10, getsockopt(t, conn, unix.IPPROTO_IP, unix.IP_TOS))
+		assert.Equal(t, 0, getsockopt(t, conn, unix.IPPROTO_TCP, unix.TCP_NODELAY))
+
+		// the kernel doubles the requested sizes, for bookkeeping
+		assert.True(t, getsockopt(t, conn, unix.SOL_SOCKET, unix.SO_SNDBUF) >= 1<<16)
+		assert.True(t, getsockopt(t, conn, unix.SOL_SOCKET, unix.SO_RCVBUF) >= 1<<17)
+	}
+}
+
+func TestSockoptsDefault(t *testing.T) {
+	l, accepted, dialed := sockets(t, New(OptKeepAlive(KeepAlive{})))
+	defer l.Close()
+	defer accepted.Close()
+	defer dialed.Close()
+
+	for _, conn := range []net.Conn{accepted, dialed} {
+		assert.Equal(t, 0, getsockopt(t, conn, unix.SOL_SOCKET, unix.SO_KEEPALIVE))
+		assert.Equal(t, 1, getsockopt(t, conn, unix.IPPROTO_TCP, unix.TCP_NODELAY))
+	}
+}
+
+func TestReusePort(t *testing.T) {
+	tp := New(OptReusePort(true))
+
+	l, err := tp.Listen(context.Background(), &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	l2, err := tp.Listen(context.Background(), l.Addr())
+	if assert.NoError(t, err) {
+		l2.Close()
+	}
+
+	_, err = New().Listen(context.Background(), l.Addr())
+	assert.Error(t, err, "bound without SO_REUSEPORT")
+}
+
+func TestSockoptsListener(t *testing.T) {
+	a := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+	l, err := New(OptNoDelay(false), OptListener(generic.Activation{})).Listen(context.Background(), a)
+	if assert.NoError(t, err) {
+		l.Close()
+	}
+
+	_, err = New(OptBuffers(1<<16, 0), OptListener(generic.Activation{})).Listen(context.Background(), a)
+	assert.Error(t, err, "socket options set on an activation listener")
+}
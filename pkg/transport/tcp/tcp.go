@@ -3,12 +3,39 @@ package tcp
 import (
 	"context"
 	"net"
+	"net/url"
 
 	pipe "github.com/lthibault/pipewerks/pkg"
 	"github.com/lthibault/pipewerks/pkg/transport/generic"
 	"github.com/pkg/errors"
 )
 
+func init() {
+	for _, scheme := range []string{"tcp", "tcp4", "tcp6"} {
+		pipe.Register(scheme, fromURL)
+	}
+}
+
+// fromURL leaves hostnames unresolved, so that they are resolved when dialing.
+// This allows dialers such as generic.SOCKS5 to resolve them remotely.
+func fromURL(u *url.URL) (pipe.Transport, net.Addr, error) {
+	host, _, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "tcp")
+	}
+
+	if host != "" && net.ParseIP(host) == nil {
+		return New(), generic.HostAddr{Net: u.Scheme, Host: u.Host}, nil
+	}
+
+	a, err := net.ResolveTCPAddr(u.Scheme, u.Host)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "tcp")
+	}
+
+	return New(), a, nil
+}
+
 func checkNetwork(a net.Addr) (ok bool) {
 	switch a.Network() {
 	case "tcp", "tcp4", "tcp6":
@@ -18,8 +45,13 @@ func checkNetwork(a net.Addr) (ok bool) {
 	return
 }
 
-// Transport over TCP
-type Transport struct{ generic.Transport }
+// Transport over TCP.  Socket options can only be set when the listener is a
+// net.ListenConfig and the dialer a net.Dialer.
+type Transport struct {
+	generic.Transport
+	so    sockopts
+	delay bool
+}
 
 // Listen TCP
 func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
@@ -27,6 +59,12 @@ func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error)
 		return nil, errors.Errorf("tcp: invalid network %s", a.Network())
 	}
 
+	l, err := t.netListener()
+	if err != nil {
+		return nil, err
+	}
+
+	t.Transport.NetListener = l
 	return t.Transport.Listen(c, a)
 }
 
@@ -36,9 +74,35 @@ func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
 		return nil, errors.Errorf("tcp: invalid network %s", a.Network())
 	}
 
+	d, err := t.netDialer()
+	if err != nil {
+		return nil, err
+	}
+
+	t.Transport.NetDialer = d
 	return t.Transport.Dial(c, a)
 }
 
+// netListener with the socket options applied
+func (t Transport) netListener() (generic.NetListener, error) {
+	l, err := t.so.listener(t.Transport.NetListener)
+	if err == nil && t.delay {
+		l = delayListener{l}
+	}
+
+	return l, err
+}
+
+// netDialer with the socket options applied
+func (t Transport) netDialer() (generic.NetDialer, error) {
+	d, err := t.so.dialer(t.Transport.NetDialer)
+	if err == nil && t.delay {
+		d = delayDialer{d}
+	}
+
+	return d, err
+}
+
 // New TCP Transport
 func New(opt ...Option) (t Transport) {
 	t.Transport = generic.New()
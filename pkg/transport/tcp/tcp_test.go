@@ -0,0 +1,31 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURL(t *testing.T) {
+	t.Run("IP", func(t *testing.T) {
+		tp, a, err := pipe.DefaultRegistry.Resolve("tcp://127.0.0.1:9001")
+		assert.NoError(t, err)
+		assert.IsType(t, Transport{}, tp)
+		assert.Equal(t, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9001}, a)
+	})
+
+	t.Run("Hostname", func(t *testing.T) {
+		// resolved when dialing, e.g. by a SOCKS5 proxy
+		_, a, err := pipe.DefaultRegistry.Resolve("tcp4://example.invalid:9001")
+		assert.NoError(t, err)
+		assert.Equal(t, generic.HostAddr{Net: "tcp4", Host: "example.invalid:9001"}, a)
+	})
+
+	t.Run("MissingPort", func(t *testing.T) {
+		_, _, err := pipe.DefaultRegistry.Resolve("tcp://localhost")
+		assert.Error(t, err)
+	})
+}
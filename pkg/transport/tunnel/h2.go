@@ -0,0 +1,79 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+// connectH2 opens an HTTP/2 CONNECT stream over a dedicated connection to the
+// proxy, as described in RFC 7540, section 8.3.
+func connectH2(c context.Context, tc *tls.Conn, h http.Header, address string) (net.Conn, error) {
+	cc, err := new(http2.Transport).NewClientConn(tc)
+	if err != nil {
+		return tc, errors.Wrap(err, "http2")
+	}
+
+	// The stream outlives the dial context, which only bounds the handshake.
+	rc, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+
+	pr, pw := io.Pipe()
+	req := (&http.Request{
+		Method:        http.MethodConnect,
+		URL:           &url.URL{Host: address},
+		Host:          address,
+		Header:        h,
+		Body:          pr,
+		ContentLength: -1,
+	}).WithContext(rc)
+
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		cancel()
+		return tc, errors.Wrap(err, "connect")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return tc, errors.Errorf("connect: proxy returned %s", resp.Status)
+	}
+
+	return &h2Conn{Conn: tc, r: resp.Body, w: pw, cc: cc, cancel: cancel}, nil
+}
+
+// h2Conn carries a byte stream over an HTTP/2 CONNECT stream.  Deadlines apply
+// to the underlying connection, which is dedicated to the stream.
+type h2Conn struct {
+	net.Conn
+	r      io.ReadCloser
+	w      *io.PipeWriter
+	cc     *http2.ClientConn
+	cancel func()
+}
+
+func (c *h2Conn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c *h2Conn) Write(b []byte) (int, error) { return c.w.Write(b) }
+
+func (c *h2Conn) Close() error {
+	c.w.Close()
+	c.r.Close()
+	c.cancel()
+	c.cc.Close()
+	return c.Conn.Close()
+}
@@ -0,0 +1,227 @@
+// Package tunnel dials connections through HTTP CONNECT proxies.
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/lthibault/pipewerks/pkg/transport/tcp"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyFromEnvironment selects a proxy using the HTTPS_PROXY and NO_PROXY
+// environment variables, or their lowercase versions.  HTTP_PROXY is used if
+// HTTPS_PROXY is unset.  As with net/http, requests to localhost are never
+// proxied.
+func ProxyFromEnvironment(target *url.URL) (*url.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	if cfg.HTTPSProxy == "" {
+		cfg.HTTPSProxy = cfg.HTTPProxy
+	}
+
+	return cfg.ProxyFunc()(target)
+}
+
+// ProxyURL returns a proxy function that always returns the same URL
+func ProxyURL(u *url.URL) func(*url.URL) (*url.URL, error) {
+	return func(*url.URL) (*url.URL, error) { return u, nil }
+}
+
+// Dialer establishes connections through HTTP CONNECT tunnels.  It satisfies
+// generic.NetDialer.
+type Dialer struct {
+	// Proxy returns the URL of the proxy for a target, whose scheme is always
+	// "https".  A nil URL means the target is dialed directly.  If Proxy is nil,
+	// ProxyFromEnvironment is used.  Credentials in the proxy URL are sent using
+	// basic authentication.
+	Proxy func(target *url.URL) (*url.URL, error)
+
+	// Forward dials the proxy, or the target if no proxy is used.  Defaults to a
+	// net.Dialer.
+	Forward generic.NetDialer
+
+	// TLSClientConfig is used for https proxies
+	TLSClientConfig *tls.Config
+
+	// HTTP2 enables HTTP/2 CONNECT for https proxies that negotiate it.  Tunnels
+	// otherwise use HTTP/1.1.
+	HTTP2 bool
+
+	// Header is sent with each CONNECT request
+	Header http.Header
+}
+
+// DialContext connects to the address through the proxy
+func (d *Dialer) DialContext(c context.Context, network, address string) (net.Conn, error) {
+	proxy, err := d.proxy(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "proxy")
+	}
+
+	if proxy == nil {
+		return d.forward().DialContext(c, network, address)
+	}
+
+	conn, err := d.forward().DialContext(c, "tcp", proxyAddr(proxy))
+	if err != nil {
+		return nil, errors.Wrap(err, "dial proxy")
+	}
+
+	if conn, err = d.connect(c, conn, proxy, address); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (d *Dialer) connect(c context.Context, conn net.Conn, proxy *url.URL, address string) (net.Conn, error) {
+	if proxy.Scheme == "https" {
+		tc, err := d.handshake(c, conn, proxy)
+		if err != nil {
+			return conn, errors.Wrap(err, "tls")
+		}
+
+		conn = tc
+		if tc.ConnectionState().NegotiatedProtocol == "h2" {
+			return connectH2(c, tc, d.header(proxy), address)
+		}
+	}
+
+	return connectH1(c, conn, d.header(proxy), address)
+}
+
+func (d *Dialer) handshake(c context.Context, conn net.Conn, proxy *url.URL) (*tls.Conn, error) {
+	cfg := new(tls.Config)
+	if d.TLSClientConfig != nil {
+		cfg = d.TLSClientConfig.Clone()
+	}
+
+	if cfg.ServerName == "" {
+		cfg.ServerName = proxy.Hostname()
+	}
+
+	if d.HTTP2 {
+		cfg.NextProtos = []string{"h2", "http/1.1"}
+	} else {
+		cfg.NextProtos = []string{"http/1.1"}
+	}
+
+	tc := tls.Client(conn, cfg)
+	if err := withDeadline(c, conn, tc.Handshake); err != nil {
+		return nil, err
+	}
+
+	return tc, nil
+}
+
+func (d *Dialer) proxy(address string) (*url.URL, error) {
+	proxy := d.Proxy
+	if proxy == nil {
+		proxy = ProxyFromEnvironment
+	}
+
+	return proxy(&url.URL{Scheme: "https", Host: address})
+}
+
+func (d *Dialer) forward() generic.NetDialer {
+	if d.Forward == nil {
+		return new(net.Dialer)
+	}
+
+	return d.Forward
+}
+
+func (d *Dialer) header(proxy *url.URL) http.Header {
+	h := make(http.Header)
+	for k, vs := range d.Header {
+		h[k] = append([]string(nil), vs...)
+	}
+
+	if u := proxy.User; u != nil {
+		pass, _ := u.Password()
+		cred := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + pass))
+		h.Set("Proxy-Authorization", "Basic "+cred)
+	}
+
+	return h
+}
+
+// connectH1 issues an HTTP/1.1 CONNECT request over conn
+func connectH1(c context.Context, conn net.Conn, h http.Header, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: h,
+	}
+
+	var resp *http.Response
+	br := bufio.NewReader(conn)
+	err := withDeadline(c, conn, func() (err error) {
+		if err = req.Write(conn); err != nil {
+			return
+		}
+
+		resp, err = http.ReadResponse(br, req)
+		return
+	})
+	if err != nil {
+		return conn, errors.Wrap(err, "connect")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return conn, errors.Errorf("connect: proxy returned %s", resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+// bufferedConn returns data read ahead by the response parser
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// withDeadline applies the context deadline to conn for the duration of fn
+func withDeadline(c context.Context, conn net.Conn, fn func() error) error {
+	if d, ok := c.Deadline(); ok {
+		if err := conn.SetDeadline(d); err != nil {
+			return err
+		}
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	return fn()
+}
+
+func proxyAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// New TCP Transport whose connections are dialed through d
+func New(d *Dialer, opt ...tcp.Option) tcp.Transport {
+	return tcp.New(append([]tcp.Option{tcp.OptGeneric(generic.OptDialer(d))}, opt...)...)
+}
@@ -0,0 +1,223 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/tcp"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+// proxy is a minimal HTTP CONNECT proxy, speaking HTTP/1.1 or HTTP/2
+type proxy struct {
+	user, pass string
+
+	mu     sync.Mutex
+	protos []int
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if user, pass, ok := basicAuth(r); p.user != "" && (!ok || user != p.user || pass != p.pass) {
+		http.Error(w, "auth required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	p.mu.Lock()
+	p.protos = append(p.protos, r.ProtoMajor)
+	p.mu.Unlock()
+
+	target, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+
+	if r.ProtoMajor == 2 {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		go func() {
+			io.Copy(target, r.Body)
+			target.(*net.TCPConn).CloseWrite()
+		}()
+
+		io.Copy(flushWriter{w}, target)
+		return
+	}
+
+	conn, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	go io.Copy(target, brw)
+	io.Copy(conn, target)
+}
+
+func basicAuth(r *http.Request) (user, pass string, ok bool) {
+	r2 := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+	return r2.BasicAuth()
+}
+
+type flushWriter struct{ w http.ResponseWriter }
+
+func (f flushWriter) Write(b []byte) (n int, err error) {
+	n, err = f.w.Write(b)
+	f.w.(http.Flusher).Flush()
+	return
+}
+
+func echo(t *testing.T, l pipe.Listener) {
+	conn, err := l.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	s, err := conn.AcceptStream()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	io.Copy(s, s)
+}
+
+func testTunnel(t *testing.T, d *Dialer) {
+	c, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	l, err := tcp.New().Listen(c, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	go echo(t, l)
+
+	conn, err := New(d).Dial(c, l.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	s, err := conn.OpenStream()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	var g errgroup.Group
+	g.Go(func() error {
+		_, err := io.Copy(s, bytes.NewBufferString("hello, tunnel"))
+		return errors.Wrap(err, "send")
+	})
+
+	buf := make([]byte, len("hello, tunnel"))
+	_, err = io.ReadFull(s, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello, tunnel", string(buf))
+	assert.NoError(t, g.Wait())
+}
+
+func TestHTTP1(t *testing.T) {
+	p := &proxy{user: "user", pass: "secret"}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	u.User = url.UserPassword("user", "secret")
+
+	testTunnel(t, &Dialer{Proxy: ProxyURL(u)})
+	assert.Equal(t, []int{1}, p.protos)
+}
+
+func TestHTTP2(t *testing.T) {
+	p := new(proxy)
+	srv := httptest.NewUnstartedServer(p)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	tc := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	testTunnel(t, &Dialer{Proxy: ProxyURL(u), TLSClientConfig: tc, HTTP2: true})
+	assert.Equal(t, []int{2}, p.protos)
+
+	// HTTP/1.1 over TLS, unless HTTP/2 is enabled
+	testTunnel(t, &Dialer{Proxy: ProxyURL(u), TLSClientConfig: tc})
+	assert.Equal(t, []int{2, 1}, p.protos)
+}
+
+func TestProxyAuthRequired(t *testing.T) {
+	srv := httptest.NewServer(&proxy{user: "user", pass: "secret"})
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	u.User = url.UserPassword("user", "wrong")
+
+	d := &Dialer{Proxy: ProxyURL(u)}
+	_, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:1")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "407")
+	}
+}
+
+func TestProxyFromEnvironment(t *testing.T) {
+	env := map[string]string{
+		"HTTP_PROXY":  "http://http-proxy:3128",
+		"HTTPS_PROXY": "",
+		"NO_PROXY":    "internal.example.com",
+	}
+	for _, k := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"} {
+		if v, ok := os.LookupEnv(k); ok {
+			defer os.Setenv(k, v)
+		} else {
+			defer os.Unsetenv(k)
+		}
+		os.Unsetenv(k)
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+
+	target := func(host string) *url.URL { return &url.URL{Scheme: "https", Host: host} }
+
+	u, err := ProxyFromEnvironment(target("example.com:9001"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, u) {
+		assert.Equal(t, "http-proxy:3128", u.Host)
+	}
+
+	os.Setenv("HTTPS_PROXY", "http://https-proxy:3128")
+	u, err = ProxyFromEnvironment(target("example.com:9001"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, u) {
+		assert.Equal(t, "https-proxy:3128", u.Host)
+	}
+
+	u, err = ProxyFromEnvironment(target("internal.example.com:9001"))
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+}
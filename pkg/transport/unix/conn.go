@@ -0,0 +1,37 @@
+package unix
+
+import (
+	"net"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+)
+
+// connMux wraps connections produced by a MuxAdapter, so that they expose the
+// capabilities of the underlying socket.  Connections that were wrapped by a
+// SecurityAdapter are returned as-is.
+type connMux struct{ generic.MuxAdapter }
+
+func (m connMux) AdaptServer(conn net.Conn) (pipe.Conn, error) {
+	return m.wrap(conn, m.MuxAdapter.AdaptServer)
+}
+
+func (m connMux) AdaptClient(conn net.Conn) (pipe.Conn, error) {
+	return m.wrap(conn, m.MuxAdapter.AdaptClient)
+}
+
+func (m connMux) wrap(conn net.Conn, adapt func(net.Conn) (pipe.Conn, error)) (pipe.Conn, error) {
+	pc, err := adapt(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch raw := conn.(type) {
+	case *framedConn:
+		return fileConn{credConn: newCredConn(pc, raw), raw: raw}, nil
+	case *net.UnixConn:
+		return newCredConn(pc, raw), nil
+	}
+
+	return pc, nil
+}
@@ -0,0 +1,91 @@
+package unix
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+)
+
+// Cred holds the credentials of the process at the remote end of a socket, as
+// they were when the socket was connected.
+type Cred struct {
+	PID      int32
+	UID, GID uint32
+}
+
+// CredConn reports the credentials of the remote process.  Connections
+// produced by the unix transport implement it, unless they are secured with
+// OptTLS.  Credentials are only available on Linux; elsewhere, PeerCred returns
+// an error.
+type CredConn interface {
+	pipe.Conn
+	PeerCred() (Cred, error)
+}
+
+// Policy decides whether to accept a connection from a process.  Returning an
+// error rejects the connection.
+type Policy func(Cred) error
+
+type credConn struct {
+	pipe.Conn
+	cred Cred
+	err  error
+}
+
+func newCredConn(pc pipe.Conn, sc syscall.Conn) credConn {
+	cred, err := peerCred(sc)
+	return credConn{Conn: pc, cred: cred, err: err}
+}
+
+func (c credConn) PeerCred() (Cred, error) { return c.cred, c.err }
+
+type policyListener struct {
+	generic.NetListener
+	p Policy
+}
+
+func (l policyListener) Listen(c context.Context, network, address string) (net.Listener, error) {
+	ln, err := l.NetListener.Listen(c, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return policedListener{Listener: ln, p: l.p}, nil
+}
+
+// policedListener closes connections that are rejected by its policy, before
+// they are multiplexed.  Rejections are not reported to the caller of Accept.
+type policedListener struct {
+	net.Listener
+	p Policy
+}
+
+func (l policedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.allow(conn) {
+			return conn, nil
+		}
+
+		conn.Close()
+	}
+}
+
+// allow the connection if its credentials satisfy the policy.  Connections
+// whose credentials are unknown are rejected.
+func (l policedListener) allow(conn net.Conn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+
+	cred, err := peerCred(sc)
+	return err == nil && l.p(cred) == nil
+}
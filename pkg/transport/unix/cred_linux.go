@@ -0,0 +1,28 @@
+package unix
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// peerCred queries SO_PEERCRED
+func peerCred(sc syscall.Conn) (cred Cred, err error) {
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return cred, errors.Wrap(err, "peer credentials")
+	}
+
+	var ucred *syscall.Ucred
+	cerr := rc.Control(func(fd uintptr) {
+		ucred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		return cred, errors.Wrap(err, "peer credentials")
+	}
+
+	return Cred{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, nil
+}
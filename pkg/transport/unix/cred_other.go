@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package unix
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+func peerCred(syscall.Conn) (Cred, error) {
+	return Cred{}, errors.New("unix: peer credentials are only supported on linux")
+}
@@ -0,0 +1,105 @@
+//go:build linux
+// +build linux
+
+package unix
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerCred(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tp   Transport
+	}{
+		{"Plain", New()},
+		{"FilePassing", New(OptFilePassing(true))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dc, lc, cleanup := connect(t, tc.tp)
+			defer cleanup()
+
+			for _, conn := range []interface{}{dc, lc} {
+				if !assert.Implements(t, (*CredConn)(nil), conn) {
+					continue
+				}
+
+				cred, err := conn.(CredConn).PeerCred()
+				assert.NoError(t, err)
+				assert.Equal(t, int32(os.Getpid()), cred.PID)
+				assert.Equal(t, uint32(os.Getuid()), cred.UID)
+				assert.Equal(t, uint32(os.Getgid()), cred.GID)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	var uid uint32
+	reject := func(c Cred) error {
+		if c.UID == uid {
+			return errors.New("go away")
+		}
+		return nil
+	}
+
+	t.Run("Accept", func(t *testing.T) {
+		uid = uint32(os.Getuid()) + 1
+
+		dc, lc, cleanup := connect(t, New(OptPolicy(reject)))
+		defer cleanup()
+
+		assert.NotNil(t, dc)
+		assert.NotNil(t, lc)
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		uid = uint32(os.Getuid())
+
+		a, rm := tempSock(t)
+		defer rm()
+
+		tp := New(OptPolicy(reject))
+		l, err := tp.Listen(context.Background(), a)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer l.Close()
+
+		accepted := make(chan struct{})
+		go func() {
+			if conn, err := l.Accept(); err == nil {
+				conn.Close()
+				close(accepted)
+			}
+		}()
+
+		// yamux clients do not wait for the server, so the connection is
+		// only seen to fail once it is used
+		conn, err := tp.Dial(context.Background(), a)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		if _, err = conn.OpenStream(); err == nil {
+			select {
+			case <-conn.Context().Done():
+			case <-time.After(time.Second):
+				t.Error("connection was not closed by the listener")
+			}
+		}
+
+		select {
+		case <-accepted:
+			t.Error("rejected connection was accepted")
+		case <-time.After(time.Millisecond * 50):
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package unix
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+// MaxFiles is the largest number of files that can be sent at once
+const MaxFiles = 253 // SCM_MAX_FD
+
+// FDConn can pass open files to the remote end, using SCM_RIGHTS control
+// messages.  Connections implement it when the transport is created with
+// OptFilePassing.
+//
+// Files belong to the connection rather than to any stream.  Each call to
+// SendFiles is received by a single call to RecvFiles, in order.  The files are
+// written to the socket after any stream data that was written before the call
+// to SendFiles, so applications may associate them with a stream by sending an
+// identifier on that stream beforehand.
+type FDConn interface {
+	pipe.Conn
+
+	// SendFiles sends duplicates of the files.  The caller may close its own
+	// copies once SendFiles returns.
+	SendFiles(fs ...*os.File) error
+
+	// RecvFiles blocks until files are received, or the connection is closed.
+	// Files that are not received are closed along with the connection.
+	RecvFiles() ([]*os.File, error)
+}
+
+type fileConn struct {
+	credConn
+	raw *framedConn
+}
+
+func (c fileConn) SendFiles(fs ...*os.File) error { return c.raw.sendFiles(fs) }
+func (c fileConn) RecvFiles() ([]*os.File, error) { return c.raw.recvFiles() }
+
+type fileDialer struct{ generic.NetDialer }
+
+func (d fileDialer) DialContext(c context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.NetDialer.DialContext(c, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFramedConn(conn)
+}
+
+type fileListener struct{ generic.NetListener }
+
+func (l fileListener) Listen(c context.Context, network, address string) (net.Listener, error) {
+	ln, err := l.NetListener.Listen(c, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return framedListener{ln}, nil
+}
+
+type framedListener struct{ net.Listener }
+
+func (l framedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return newFramedConn(conn)
+}
+
+// Frames are preceded by a header holding their type and length.  The length
+// of a file frame is the number of files, which are carried by a control
+// message attached to the header.
+const (
+	frameData byte = iota
+	frameFiles
+
+	headerSize = 5
+)
+
+// framedConn interleaves stream data and files on a unix socket.  Control
+// messages must be attached to at least one byte of data, which would otherwise
+// corrupt the multiplexer's byte stream.
+type framedConn struct {
+	*net.UnixConn
+
+	wmu sync.Mutex
+
+	rmu    sync.Mutex
+	remain int        // bytes left in the current data frame
+	oob    []byte     // control message buffer
+	fds    []*os.File // received, but not yet framed
+
+	qmu    sync.Mutex
+	queue  [][]*os.File
+	ready  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func newFramedConn(conn net.Conn) (*framedConn, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.Errorf("unix: cannot pass files over %T", conn)
+	}
+
+	return &framedConn{
+		UnixConn: uc,
+		oob:      make([]byte, rightsSpace(MaxFiles)),
+		ready:    make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+func (c *framedConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	hdr := header(frameData, len(b))
+	n, err := (&net.Buffers{hdr, b}).WriteTo(c.UnixConn)
+	if n -= headerSize; n < 0 {
+		n = 0
+	}
+
+	return int(n), err
+}
+
+func (c *framedConn) sendFiles(fs []*os.File) error {
+	if len(fs) == 0 {
+		return nil
+	}
+
+	if len(fs) > MaxFiles {
+		return errors.Errorf("unix: cannot send more than %d files", MaxFiles)
+	}
+
+	rights, err := unixRights(fs)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	n, _, err := c.WriteMsgUnix(header(frameFiles, len(fs)), rights, nil)
+	if err == nil && n != headerSize {
+		err = io.ErrShortWrite
+	}
+
+	return errors.Wrap(err, "send files")
+}
+
+func (c *framedConn) recvFiles() ([]*os.File, error) {
+	for {
+		c.qmu.Lock()
+		if len(c.queue) > 0 {
+			fs := c.queue[0]
+			c.queue = c.queue[1:]
+			c.qmu.Unlock()
+			return fs, nil
+		}
+		c.qmu.Unlock()
+
+		select {
+		case <-c.ready:
+		case <-c.closed:
+			// files may have been queued before the connection failed
+			c.qmu.Lock()
+			n := len(c.queue)
+			c.qmu.Unlock()
+			if n == 0 {
+				return nil, c.err
+			}
+		}
+	}
+}
+
+func (c *framedConn) Read(b []byte) (n int, err error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for c.remain == 0 {
+		var hdr [headerSize]byte
+		if err = c.readFull(hdr[:]); err != nil {
+			return 0, c.fail(err)
+		}
+
+		length := int(binary.BigEndian.Uint32(hdr[1:]))
+		switch hdr[0] {
+		case frameData:
+			c.remain = length
+		case frameFiles:
+			if err = c.frameFiles(length); err != nil {
+				return 0, c.fail(err)
+			}
+		default:
+			return 0, c.fail(errors.Errorf("unix: invalid frame type %d", hdr[0]))
+		}
+	}
+
+	if len(b) > c.remain {
+		b = b[:c.remain]
+	}
+
+	if n, err = c.read(b); err != nil {
+		c.fail(err)
+	}
+	c.remain -= n
+	return
+}
+
+func (c *framedConn) readFull(b []byte) error {
+	for len(b) > 0 {
+		n, err := c.read(b)
+		if err != nil {
+			if err == io.EOF && len(b) < headerSize {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// read from the socket, collecting any files that arrive
+func (c *framedConn) read(b []byte) (int, error) {
+	n, oobn, flags, _, err := c.ReadMsgUnix(b, c.oob)
+	if oobn > 0 {
+		fs, perr := parseRights(c.oob[:oobn])
+		c.fds = append(c.fds, fs...)
+		if err == nil {
+			err = perr
+		}
+	}
+
+	// Files that are never framed would otherwise accumulate without bound.
+	if err == nil && len(c.fds) > MaxFiles {
+		err = errors.New("unix: too many unframed files")
+	}
+
+	if err == nil && truncated(flags) {
+		err = errors.New("unix: control message truncated")
+	}
+
+	if n == 0 && err == nil {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// frameFiles queues the next n files received from the socket
+func (c *framedConn) frameFiles(n int) error {
+	if n > len(c.fds) {
+		return errors.New("unix: missing files")
+	}
+
+	fs := make([]*os.File, n)
+	copy(fs, c.fds)
+	c.fds = c.fds[n:]
+
+	c.qmu.Lock()
+	c.queue = append(c.queue, fs)
+	c.qmu.Unlock()
+
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// fail records the first read error, which ends the stream of files.  Timeouts
+// are not fatal.
+func (c *framedConn) fail(err error) error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return err
+	}
+
+	c.once.Do(func() {
+		c.err = errors.Wrap(err, "recv files")
+		close(c.closed)
+	})
+	return err
+}
+
+// Close the connection, along with any files that were not received
+func (c *framedConn) Close() error {
+	err := c.UnixConn.Close()
+
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	c.fail(errors.New("unix: connection closed"))
+
+	closeFiles(c.fds)
+	c.fds = nil
+
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+	for _, fs := range c.queue {
+		closeFiles(fs)
+	}
+	c.queue = nil
+
+	return err
+}
+
+func header(typ byte, length int) []byte {
+	hdr := make([]byte, headerSize)
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], uint32(length))
+	return hdr
+}
+
+func closeFiles(fs []*os.File) {
+	for _, f := range fs {
+		f.Close()
+	}
+}
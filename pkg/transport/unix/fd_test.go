@@ -0,0 +1,152 @@
+package unix
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func tempSock(t *testing.T) (*net.UnixAddr, func()) {
+	dir, err := ioutil.TempDir("", "pipewerks-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &net.UnixAddr{Net: "unix", Name: filepath.Join(dir, "sock")}
+	return a, func() { os.RemoveAll(dir) }
+}
+
+func connect(t *testing.T, tp Transport) (dc, lc pipe.Conn, cleanup func()) {
+	a, rm := tempSock(t)
+	dc, lc, done := connectAddr(t, tp, a)
+	return dc, lc, func() {
+		done()
+		rm()
+	}
+}
+
+func connectAddr(t *testing.T, tp Transport, a net.Addr) (dc, lc pipe.Conn, cleanup func()) {
+	l, err := tp.Listen(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		lc, err = l.Accept()
+		return
+	})
+	g.Go(func() (err error) {
+		dc, err = tp.Dial(context.Background(), a)
+		return
+	})
+	if err = g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	return dc, lc, func() {
+		dc.Close()
+		lc.Close()
+		l.Close()
+	}
+}
+
+func TestFilePassing(t *testing.T) {
+	dc, lc, cleanup := connect(t, New(OptFilePassing(true)))
+	defer cleanup()
+
+	if !assert.Implements(t, (*FDConn)(nil), dc) || !assert.Implements(t, (*FDConn)(nil), lc) {
+		return
+	}
+
+	t.Run("Pipe", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer w.Close()
+
+		var g errgroup.Group
+		g.Go(func() error {
+			defer r.Close() // the peer holds its own copy
+			return dc.(FDConn).SendFiles(r)
+		})
+
+		fs, err := lc.(FDConn).RecvFiles()
+		assert.NoError(t, err)
+		assert.NoError(t, g.Wait())
+		if !assert.Len(t, fs, 1) {
+			return
+		}
+		defer fs[0].Close()
+
+		_, err = io.WriteString(w, "through the pipe")
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+
+		b, err := ioutil.ReadAll(fs[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "through the pipe", string(b))
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		// files sent after stream data are received after it
+		var g errgroup.Group
+		g.Go(func() error {
+			s, err := dc.OpenStream()
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if _, err = io.WriteString(s, "files follow"); err != nil {
+				return err
+			}
+
+			return dc.(FDConn).SendFiles(os.Stdin, os.Stdout)
+		})
+
+		s, err := lc.AcceptStream()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer s.Close()
+
+		fs, err := lc.(FDConn).RecvFiles()
+		assert.NoError(t, err)
+		assert.Len(t, fs, 2)
+		closeFiles(fs)
+
+		b := make([]byte, len("files follow"))
+		_, err = io.ReadFull(s, b)
+		assert.NoError(t, err)
+		assert.Equal(t, "files follow", string(b))
+		assert.NoError(t, g.Wait())
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		dc.Close()
+
+		_, err := lc.(FDConn).RecvFiles()
+		assert.Error(t, err)
+	})
+}
+
+func TestFilePassingDisabled(t *testing.T) {
+	dc, lc, cleanup := connect(t, New())
+	defer cleanup()
+
+	_, ok := dc.(FDConn)
+	assert.False(t, ok)
+
+	_, ok = lc.(FDConn)
+	assert.False(t, ok)
+}
@@ -1,7 +1,9 @@
 package unix
 
 import (
+	"crypto/tls"
 	"net"
+	"os"
 
 	"github.com/lthibault/pipewerks/pkg/transport/generic"
 )
@@ -9,14 +11,9 @@ import (
 // Option for Unix transport
 type Option func(*Transport) (prev Option)
 
-// OptListener sets the ListenConfig
-func OptListener(l *net.ListenConfig) Option {
-	return func(t *Transport) (prev Option) {
-		prev = OptListener(t.Transport.NetListener.(*net.ListenConfig))
-		OptGeneric(generic.OptListener(l))(t)
-		return
-	}
-}
+// OptListener sets the listener, e.g. a net.ListenConfig, a generic.Activation
+// or a handoff.Upgrader
+func OptListener(l generic.NetListener) Option { return OptGeneric(generic.OptListener(l)) }
 
 // OptDialer sets the dialer
 func OptDialer(d *net.Dialer) Option {
@@ -27,6 +24,68 @@ func OptDialer(d *net.Dialer) Option {
 	}
 }
 
+// OptTLS secures connections with TLS before they are multiplexed
+func OptTLS(c *tls.Config) Option { return OptGeneric(generic.OptTLS(c)) }
+
+// OptFilePassing makes connections implement FDConn.  Stream data is framed so
+// that files can be sent alongside it, hence both ends MUST enable it.
+// Connections secured with OptTLS cannot pass files.
+func OptFilePassing(enable bool) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptFilePassing(t.files)
+		t.files = enable
+		return
+	}
+}
+
+// OptPolicy admits incoming connections according to the credentials of the
+// remote process.  Rejected connections are closed before they are
+// multiplexed.  A nil policy admits all connections.
+func OptPolicy(p Policy) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptPolicy(t.policy)
+		t.policy = p
+		return
+	}
+}
+
+// OptRemoveStale removes the socket file before listening, if it was left
+// behind by a process that is no longer listening on it.  Listen fails if the
+// socket is in use, or if the file is not a socket.
+func OptRemoveStale(enable bool) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptRemoveStale(t.stale)
+		t.stale = enable
+		return
+	}
+}
+
+// OptMode sets the permissions of the socket file.  The socket is bound in a
+// private directory and linked into place once they are applied.  Zero leaves
+// them as determined by the umask.
+func OptMode(mode os.FileMode) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptMode(t.mode)
+		t.mode = mode
+		return
+	}
+}
+
+// OptOwner sets the owner and group of the socket file.  The socket is bound in
+// a private directory and linked into place once they are applied.  An ID of -1
+// leaves it unchanged.
+func OptOwner(uid, gid int) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptOwner(-1, -1)
+		if t.chown {
+			prev = OptOwner(t.uid, t.gid)
+		}
+
+		t.chown, t.uid, t.gid = true, uid, gid
+		return
+	}
+}
+
 // OptGeneric sets an option on the underlying generic transport
 func OptGeneric(opt generic.Option) Option {
 	return func(t *Transport) Option {
@@ -0,0 +1,594 @@
+package unix
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+)
+
+// MaxMessageSize is the largest message that can be written to a stream over a
+// unixpacket socket.
+const MaxMessageSize = 1 << 16
+
+const (
+	packetHeaderSize = 5 // type, then stream ID
+
+	// streamWindow is the number of messages a stream may send before the
+	// receiver grants more credit.
+	streamWindow = 64
+
+	acceptBacklog = 256
+)
+
+// Packet types
+const (
+	pktOpen byte = iota
+	pktData
+	pktCredit // payload holds the number of messages consumed
+	pktFin
+	pktReset
+)
+
+var errConnClosed = errors.New("unix: connection closed")
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "unix: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// packetMux multiplexes streams over a connection that preserves message
+// boundaries, such as a unixpacket socket.  Each message written to a stream is
+// sent as a single packet, and returned by a single call to Read at the remote
+// end, provided the buffer is large enough.  Otherwise, the remainder of the
+// message is returned by subsequent calls.
+type packetMux struct{}
+
+func (packetMux) AdaptServer(conn net.Conn) (pipe.Conn, error) {
+	return newPacketConn(conn, false), nil
+}
+
+func (packetMux) AdaptClient(conn net.Conn) (pipe.Conn, error) {
+	return newPacketConn(conn, true), nil
+}
+
+type packetConn struct {
+	raw    net.Conn
+	c      context.Context
+	cancel func()
+	once   sync.Once
+
+	wmu sync.Mutex
+
+	// Credits and resets are queued for the control loop, which coalesces
+	// them, so that the read loop never waits on the socket.
+	cmu     sync.Mutex
+	credits map[uint32]int
+	resets  map[uint32]struct{}
+	ctl     chan struct{}
+
+	mu      sync.Mutex
+	streams map[uint32]*packetStream
+	next    uint32
+
+	accept chan *packetStream
+}
+
+func newPacketConn(raw net.Conn, client bool) *packetConn {
+	c := &packetConn{
+		raw:     raw,
+		credits: make(map[uint32]int),
+		resets:  make(map[uint32]struct{}),
+		ctl:     make(chan struct{}, 1),
+		streams: make(map[uint32]*packetStream),
+		next:    2,
+		accept:  make(chan *packetStream, acceptBacklog),
+	}
+	c.c, c.cancel = context.WithCancel(context.Background())
+
+	// streams opened by clients have odd IDs, as in yamux
+	if client {
+		c.next = 1
+	}
+
+	go c.readLoop()
+	go c.controlLoop()
+	return c
+}
+
+func (c *packetConn) Context() context.Context { return c.c }
+func (c *packetConn) LocalAddr() net.Addr      { return c.raw.LocalAddr() }
+func (c *packetConn) RemoteAddr() net.Addr     { return c.raw.RemoteAddr() }
+
+func (c *packetConn) Close() (err error) {
+	c.once.Do(func() {
+		c.cancel()
+		err = c.raw.Close()
+	})
+	return
+}
+
+func (c *packetConn) OpenStream() (pipe.Stream, error) {
+	c.mu.Lock()
+	if c.c.Err() != nil {
+		c.mu.Unlock()
+		return nil, errConnClosed
+	}
+
+	s := newPacketStream(c, c.next)
+	c.streams[s.id] = s
+	c.next += 2
+	c.mu.Unlock()
+
+	if err := c.send(pktOpen, s.id, nil); err != nil {
+		c.remove(s.id)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (c *packetConn) AcceptStream() (pipe.Stream, error) {
+	select {
+	case s := <-c.accept:
+		return s, nil
+	case <-c.c.Done():
+		return nil, errConnClosed
+	}
+}
+
+// send a packet.  Writes to a packet socket are atomic.
+func (c *packetConn) send(typ byte, id uint32, payload []byte) error {
+	b := make([]byte, packetHeaderSize+len(payload))
+	b[0] = typ
+	binary.BigEndian.PutUint32(b[1:], id)
+	copy(b[packetHeaderSize:], payload)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if _, err := c.raw.Write(b); err != nil {
+		c.Close()
+		return errors.Wrap(err, "unix: send")
+	}
+
+	return nil
+}
+
+// sendCredit grants the remote end of a stream credit for n more messages
+func (c *packetConn) sendCredit(id uint32, n int) {
+	c.cmu.Lock()
+	c.credits[id] += n
+	c.cmu.Unlock()
+
+	notify(c.ctl)
+}
+
+// sendReset resets the remote end of a stream
+func (c *packetConn) sendReset(id uint32) {
+	c.cmu.Lock()
+	c.resets[id] = struct{}{}
+	delete(c.credits, id)
+	c.cmu.Unlock()
+
+	notify(c.ctl)
+}
+
+// controlLoop sends queued credits and resets.  Were they sent by the read loop,
+// two peers whose writers were blocked on full sockets would each wait for the
+// other to read.
+func (c *packetConn) controlLoop() {
+	for {
+		select {
+		case <-c.ctl:
+		case <-c.c.Done():
+			return
+		}
+
+		c.cmu.Lock()
+		credits, resets := c.credits, c.resets
+		c.credits, c.resets = make(map[uint32]int), make(map[uint32]struct{})
+		c.cmu.Unlock()
+
+		for id, n := range credits {
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], uint32(n))
+			if c.send(pktCredit, id, b[:]) != nil {
+				return
+			}
+		}
+
+		for id := range resets {
+			if c.send(pktReset, id, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *packetConn) readLoop() {
+	defer c.teardown()
+
+	// one extra byte detects oversized packets, which would be truncated
+	buf := make([]byte, packetHeaderSize+MaxMessageSize+1)
+	for {
+		n, err := c.raw.Read(buf)
+		if err != nil || n < packetHeaderSize || n > packetHeaderSize+MaxMessageSize {
+			return
+		}
+
+		typ, id := buf[0], binary.BigEndian.Uint32(buf[1:])
+		if !c.dispatch(typ, id, buf[packetHeaderSize:n]) {
+			return
+		}
+	}
+}
+
+// dispatch a packet.  It returns false if the remote end violated the protocol.
+func (c *packetConn) dispatch(typ byte, id uint32, payload []byte) bool {
+	c.mu.Lock()
+	s, ok := c.streams[id]
+
+	if typ == pktOpen {
+		// remote streams have the other parity
+		if ok || id%2 == c.next%2 {
+			c.mu.Unlock()
+			return false
+		}
+
+		if len(c.accept) == cap(c.accept) {
+			c.mu.Unlock()
+			c.sendReset(id)
+			return true
+		}
+
+		s = newPacketStream(c, id)
+		c.streams[id] = s
+		c.mu.Unlock()
+
+		c.accept <- s // cannot block; this is the only sender
+		return true
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		if typ == pktData {
+			c.sendReset(id)
+		}
+		return true
+	}
+
+	switch typ {
+	case pktData:
+		s.push(payload)
+	case pktCredit:
+		if len(payload) != 4 {
+			return false
+		}
+		s.grant(int(binary.BigEndian.Uint32(payload)))
+	case pktFin:
+		s.finish()
+	case pktReset:
+		s.reset(errors.New("unix: stream reset by peer"))
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (c *packetConn) remove(id uint32) {
+	c.mu.Lock()
+	delete(c.streams, id)
+	c.mu.Unlock()
+}
+
+// teardown the connection and its streams, once the socket fails
+func (c *packetConn) teardown() {
+	c.Close()
+
+	c.mu.Lock()
+	ss := make([]*packetStream, 0, len(c.streams))
+	for _, s := range c.streams {
+		ss = append(ss, s)
+	}
+	c.streams = nil
+	c.mu.Unlock()
+
+	for _, s := range ss {
+		s.reset(errConnClosed)
+	}
+}
+
+type packetStream struct {
+	conn   *packetConn
+	id     uint32
+	c      context.Context
+	cancel func()
+
+	mu       sync.Mutex
+	queue    [][]byte
+	cur      []byte // remainder of the message being read
+	consumed int    // messages read since credit was last granted
+	credit   int    // messages that may be sent
+
+	eof, rclosed, wclosed bool
+	err                   error
+
+	rd, wd          time.Time
+	chRead, chWrite chan struct{}
+}
+
+func newPacketStream(conn *packetConn, id uint32) *packetStream {
+	s := &packetStream{
+		conn:    conn,
+		id:      id,
+		credit:  streamWindow,
+		chRead:  make(chan struct{}, 1),
+		chWrite: make(chan struct{}, 1),
+	}
+	s.c, s.cancel = context.WithCancel(conn.c)
+	return s
+}
+
+func (s *packetStream) Context() context.Context { return s.c }
+func (s *packetStream) StreamID() uint32         { return s.id }
+func (s *packetStream) LocalAddr() net.Addr      { return s.conn.LocalAddr() }
+func (s *packetStream) RemoteAddr() net.Addr     { return s.conn.RemoteAddr() }
+
+// push a message received from the remote end
+func (s *packetStream) push(payload []byte) {
+	s.mu.Lock()
+	switch {
+	case s.rclosed:
+		// discard, but keep the sender going
+		s.mu.Unlock()
+		s.conn.sendCredit(s.id, 1)
+		return
+
+	case len(s.queue) >= streamWindow:
+		s.mu.Unlock()
+		s.conn.sendReset(s.id)
+		s.reset(errors.New("unix: stream window exceeded"))
+		return
+	}
+
+	s.queue = append(s.queue, append([]byte(nil), payload...))
+	s.mu.Unlock()
+
+	notify(s.chRead)
+}
+
+func (s *packetStream) grant(n int) {
+	s.mu.Lock()
+	s.credit += n
+	s.mu.Unlock()
+
+	notify(s.chWrite)
+}
+
+func (s *packetStream) finish() {
+	s.mu.Lock()
+	s.eof = true
+	s.mu.Unlock()
+
+	notify(s.chRead)
+}
+
+func (s *packetStream) reset(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+
+	s.cancel()
+	notify(s.chRead)
+	notify(s.chWrite)
+}
+
+// Read the next message, or the remainder of the current one
+func (s *packetStream) Read(b []byte) (n int, err error) {
+	for {
+		s.mu.Lock()
+		if s.rclosed {
+			s.mu.Unlock()
+			return 0, io.ErrClosedPipe
+		}
+
+		if s.cur == nil && len(s.queue) > 0 {
+			s.cur, s.queue = s.queue[0], s.queue[1:]
+
+			var grant int
+			if s.consumed++; s.consumed >= streamWindow/2 {
+				grant, s.consumed = s.consumed, 0
+			}
+			s.mu.Unlock()
+
+			if grant > 0 {
+				s.conn.sendCredit(s.id, grant)
+			}
+			continue
+		}
+
+		if s.cur != nil {
+			n = copy(b, s.cur)
+			if s.cur = s.cur[n:]; len(s.cur) == 0 {
+				s.cur = nil
+			}
+			s.mu.Unlock()
+			return
+		}
+
+		if s.err != nil {
+			s.mu.Unlock()
+			return 0, s.err
+		}
+
+		if s.eof {
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+
+		deadline := s.rd
+		s.mu.Unlock()
+
+		if err = s.wait(s.chRead, deadline); err != nil {
+			return
+		}
+	}
+}
+
+// Write b as a single message, which may not exceed MaxMessageSize
+func (s *packetStream) Write(b []byte) (int, error) {
+	if len(b) > MaxMessageSize {
+		return 0, errors.Errorf("unix: message exceeds %d bytes", MaxMessageSize)
+	}
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		s.mu.Lock()
+		if s.wclosed {
+			s.mu.Unlock()
+			return 0, io.ErrClosedPipe
+		}
+
+		if s.err != nil {
+			s.mu.Unlock()
+			return 0, s.err
+		}
+
+		if s.credit > 0 {
+			s.credit--
+			s.mu.Unlock()
+
+			if err := s.conn.send(pktData, s.id, b); err != nil {
+				return 0, err
+			}
+			return len(b), nil
+		}
+
+		deadline := s.wd
+		s.mu.Unlock()
+
+		if err := s.wait(s.chWrite, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *packetStream) wait(ch <-chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return timeoutError{}
+		}
+
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return timeoutError{}
+	case <-s.conn.c.Done():
+		return errConnClosed
+	}
+}
+
+// CloseWrite sends a FIN to the remote end
+func (s *packetStream) CloseWrite() error {
+	s.mu.Lock()
+	if s.wclosed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.wclosed = true
+	reset := s.err != nil
+	s.mu.Unlock()
+
+	notify(s.chWrite)
+	if reset || s.conn.c.Err() != nil {
+		return nil // nothing to close
+	}
+
+	return s.conn.send(pktFin, s.id, nil)
+}
+
+// CloseRead discards queued and future messages, which are acknowledged so
+// that the remote end is not blocked.  It is not signalled to the remote end.
+func (s *packetStream) CloseRead() error {
+	s.mu.Lock()
+	if s.rclosed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.rclosed = true
+	grant := s.consumed + len(s.queue)
+	s.queue, s.cur, s.consumed = nil, nil, 0
+	s.mu.Unlock()
+
+	notify(s.chRead)
+	if grant > 0 {
+		s.conn.sendCredit(s.id, grant)
+	}
+	return nil
+}
+
+// Close both sides of the stream.  Messages that arrive afterwards are
+// answered with a reset.
+func (s *packetStream) Close() error {
+	s.CloseRead()
+	err := s.CloseWrite()
+	s.conn.remove(s.id)
+	s.cancel()
+	return err
+}
+
+func (s *packetStream) SetDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.rd, s.wd = t, t
+	s.mu.Unlock()
+
+	notify(s.chRead)
+	notify(s.chWrite)
+	return nil
+}
+
+func (s *packetStream) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.rd = t
+	s.mu.Unlock()
+
+	notify(s.chRead)
+	return nil
+}
+
+func (s *packetStream) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.wd = t
+	s.mu.Unlock()
+
+	notify(s.chWrite)
+	return nil
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
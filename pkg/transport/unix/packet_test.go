@@ -0,0 +1,197 @@
+//go:build linux
+// +build linux
+
+package unix
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func packetAddr(t *testing.T) (*net.UnixAddr, func()) {
+	a, rm := tempSock(t)
+	a.Net = "unixpacket"
+	return a, rm
+}
+
+func TestPacketIntegration(t *testing.T) {
+	a, rm := packetAddr(t)
+	defer rm()
+
+	tp := New()
+	l, err := tp.Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { assert.NoError(t, l.Close()) }()
+
+	transporttest.RunListener(t, tp, l, a)
+}
+
+func packetStreams(t *testing.T) (ds, ls pipe.Stream, cleanup func()) {
+	a, rm := packetAddr(t)
+	dc, lc, done := connectAddr(t, New(), a)
+
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		ls, err = lc.AcceptStream()
+		return
+	})
+	g.Go(func() (err error) {
+		ds, err = dc.OpenStream()
+		return
+	})
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	return ds, ls, func() {
+		done()
+		rm()
+	}
+}
+
+func TestPacketBoundaries(t *testing.T) {
+	ds, ls, cleanup := packetStreams(t)
+	defer cleanup()
+
+	sizes := []int{1, 100, 5000, MaxMessageSize}
+	go func() {
+		for _, n := range sizes {
+			ds.Write(bytes.Repeat([]byte{byte(n)}, n))
+		}
+		ds.Write([]byte("split me"))
+		ds.CloseWrite()
+	}()
+
+	buf := make([]byte, MaxMessageSize)
+	for _, n := range sizes {
+		got, err := ls.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, n, got, "message boundary not preserved")
+	}
+
+	// the remainder of a message is returned by subsequent reads
+	small := make([]byte, 5)
+	n, err := ls.Read(small)
+	assert.NoError(t, err)
+	assert.Equal(t, "split", string(small[:n]))
+
+	n, err = ls.Read(small)
+	assert.NoError(t, err)
+	assert.Equal(t, " me", string(small[:n]))
+
+	_, err = ls.Read(small)
+	assert.Equal(t, io.EOF, err)
+
+	t.Run("Oversized", func(t *testing.T) {
+		_, err := ls.Write(make([]byte, MaxMessageSize+1))
+		assert.Error(t, err)
+	})
+}
+
+func TestPacketFlowControl(t *testing.T) {
+	ds, ls, cleanup := packetStreams(t)
+	defer cleanup()
+
+	// fill the window
+	for i := 0; i < streamWindow; i++ {
+		_, err := ds.Write([]byte{byte(i)})
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	assert.NoError(t, ds.SetWriteDeadline(time.Now().Add(time.Millisecond*20)))
+	_, err := ds.Write([]byte("blocked"))
+	if assert.Error(t, err) {
+		assert.True(t, err.(net.Error).Timeout())
+	}
+	assert.NoError(t, ds.SetWriteDeadline(time.Time{}))
+
+	// reading grants credit
+	buf := make([]byte, 1)
+	for i := 0; i < streamWindow/2; i++ {
+		_, err := ls.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, byte(i), buf[0])
+	}
+
+	assert.NoError(t, ds.SetWriteDeadline(time.Now().Add(time.Second)))
+	_, err = ds.Write([]byte("unblocked"))
+	assert.NoError(t, err)
+}
+
+// TestPacketCloseRead checks that messages discarded after CloseRead are credited
+// while both ends fill the socket in either direction.  Were credit sent by the
+// read loop while another goroutine blocked on the socket, neither end would read.
+func TestPacketCloseRead(t *testing.T) {
+	ds, ls, cleanup := packetStreams(t)
+	defer cleanup()
+
+	assert.NoError(t, ds.CloseRead())
+	assert.NoError(t, ls.CloseRead())
+
+	msg := make([]byte, MaxMessageSize)
+	var g errgroup.Group
+	for _, s := range []pipe.Stream{ds, ls} {
+		s := s
+		g.Go(func() error {
+			for i := 0; i < streamWindow*8; i++ {
+				if _, err := s.Write(msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- g.Wait() }()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second * 10):
+		t.Error("writers deadlocked")
+	}
+}
+
+func TestPacketRejected(t *testing.T) {
+	a, rm := packetAddr(t)
+	defer rm()
+
+	_, err := New(OptFilePassing(true)).Listen(context.Background(), a)
+	assert.Error(t, err)
+
+	_, err = New(OptTLS(&tls.Config{})).Dial(context.Background(), a)
+	assert.Error(t, err)
+
+	_, err = New(OptGeneric(generic.OptMuxAdapter(generic.SmuxConfig{}))).Dial(context.Background(), a)
+	assert.Error(t, err)
+
+	a.Net = "unixgram"
+	_, err = New().Listen(context.Background(), a)
+	assert.Error(t, err)
+
+	_, err = New().Dial(context.Background(), a)
+	assert.Error(t, err)
+}
+
+func TestPacketURL(t *testing.T) {
+	_, a, err := pipe.DefaultRegistry.Resolve("unixpacket:///tmp/pipewerks.sock")
+	assert.NoError(t, err)
+	assert.Equal(t, "unixpacket", a.Network())
+	assert.Equal(t, "/tmp/pipewerks.sock", a.String())
+}
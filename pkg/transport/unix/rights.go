@@ -0,0 +1,68 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package unix
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+func rightsSpace(n int) int { return syscall.CmsgSpace(n * 4) }
+
+func unixRights(fs []*os.File) ([]byte, error) {
+	fds := make([]int, len(fs))
+	for i, f := range fs {
+		rc, err := f.SyscallConn()
+		if err != nil {
+			return nil, errors.Wrap(err, "unix")
+		}
+
+		// the descriptor is duplicated by the kernel when the message is
+		// sent, so it need only remain valid until then
+		if err = rc.Control(func(fd uintptr) { fds[i] = int(fd) }); err != nil {
+			return nil, errors.Wrap(err, "unix")
+		}
+	}
+
+	return syscall.UnixRights(fds...), nil
+}
+
+// parseRights returns the files carried by SCM_RIGHTS messages.  If the
+// control data is malformed, any files that were parsed are closed.
+func parseRights(oob []byte) (fs []*os.File, err error) {
+	for len(oob) >= syscall.CmsgLen(0) {
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		if int(h.Len) < syscall.CmsgLen(0) || int(h.Len) > len(oob) {
+			closeFiles(fs)
+			return nil, errors.New("control message: invalid header")
+		}
+
+		msg := syscall.SocketControlMessage{
+			Header: *h,
+			Data:   oob[syscall.CmsgLen(0):h.Len],
+		}
+
+		if fds, err := syscall.ParseUnixRights(&msg); err == nil {
+			for _, fd := range fds {
+				syscall.CloseOnExec(fd)
+				fs = append(fs, os.NewFile(uintptr(fd), "unix-rights"))
+			}
+		} // else not SCM_RIGHTS
+
+		if next := syscall.CmsgSpace(int(h.Len) - syscall.CmsgLen(0)); next < len(oob) {
+			oob = oob[next:]
+		} else {
+			oob = nil
+		}
+	}
+
+	return fs, nil
+}
+
+// truncated reports whether the kernel discarded control data, such as files
+// beyond the space available in the buffer
+func truncated(flags int) bool { return flags&syscall.MSG_CTRUNC != 0 }
@@ -0,0 +1,20 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package unix
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var errNoRights = errors.New("unix: file passing is not supported on this platform")
+
+func rightsSpace(int) int { return 0 }
+
+func unixRights([]*os.File) ([]byte, error) { return nil, errNoRights }
+
+func parseRights([]byte) ([]*os.File, error) { return nil, errNoRights }
+
+func truncated(int) bool { return false }
@@ -0,0 +1,82 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package unix
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnframedFiles(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		conn, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[i] = conn.(*net.UnixConn)
+	}
+
+	fc, err := newFramedConn(conns[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fc.Close()
+
+	// attach files to empty data frames, which never hand them to RecvFiles
+	rights, err := unixRights([]*os.File{os.Stdin, os.Stdin, os.Stdin, os.Stdin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for i := 0; i <= MaxFiles/4; i++ {
+			if _, _, err := conns[0].WriteMsgUnix(header(frameData, 0), rights, nil); err != nil {
+				return
+			}
+		}
+		conns[0].Write(header(frameData, 1))
+		conns[0].Write([]byte{0})
+	}()
+
+	_, err = fc.Read(make([]byte, 1))
+	assert.Error(t, err)
+}
+
+func TestParseRights(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// the kernel would have installed a new descriptor for the file
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a truncated message follows the valid one
+	oob := syscall.UnixRights(fd)
+	oob = append(oob, syscall.UnixRights(0)[:syscall.CmsgLen(0)]...)
+
+	_, err = parseRights(oob)
+	assert.Error(t, err)
+
+	var st syscall.Stat_t
+	assert.Equal(t, syscall.EBADF, syscall.Fstat(fd, &st),
+		"file from malformed control data was not closed")
+}
@@ -0,0 +1,171 @@
+package unix
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+// isAbstract reports whether the name is in Linux's abstract namespace.  Such
+// names begin with '@', and are not backed by a file.
+func isAbstract(name string) bool { return len(name) > 0 && name[0] == '@' }
+
+func checkAbstract(name string) error {
+	if isAbstract(name) && runtime.GOOS != "linux" {
+		return errors.Errorf("unix: abstract socket %s requires linux", name)
+	}
+
+	return nil
+}
+
+// socketFile manages the file that backs a listening socket
+type socketFile struct {
+	generic.NetListener
+
+	stale    bool
+	mode     os.FileMode
+	chown    bool
+	uid, gid int
+}
+
+func (s socketFile) Listen(c context.Context, network, address string) (net.Listener, error) {
+	if isAbstract(address) {
+		return s.NetListener.Listen(c, network, address)
+	}
+
+	// the socket may be inherited, so stale files are only removed once they
+	// are found to be in the way
+	l, err := s.bind(c, network, address)
+	if err != nil && s.stale && isInUse(err) {
+		if err = removeStale(c, network, address); err != nil {
+			return nil, err
+		}
+
+		l, err = s.bind(c, network, address)
+	}
+
+	return l, err
+}
+
+// bind the socket.  If its file is to be given other permissions or another
+// owner, it is bound in a private directory, where they are applied before it is
+// linked into place, so that other users cannot connect in the meantime.
+func (s socketFile) bind(c context.Context, network, address string) (net.Listener, error) {
+	if s.mode == 0 && !s.chown {
+		return s.NetListener.Listen(c, network, address)
+	}
+
+	// the directory must be on the same file system as the socket
+	dir, err := ioutil.TempDir(filepath.Dir(address), ".pipewerks")
+	if err != nil {
+		return nil, errors.Wrap(err, "unix")
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	l, err := s.NetListener.Listen(c, network, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.apply(tmp); err == nil {
+		// unlike rename, link does not replace an existing file
+		err = os.Link(tmp, address)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return linkedListener{Listener: l, path: address}, nil
+}
+
+// apply the mode and owner to the socket file
+func (s socketFile) apply(path string) error {
+	if s.mode != 0 {
+		if err := os.Chmod(path, s.mode); err != nil {
+			return errors.Wrap(err, "unix")
+		}
+	}
+
+	if s.chown {
+		if err := os.Chown(path, s.uid, s.gid); err != nil {
+			return errors.Wrap(err, "unix")
+		}
+	}
+
+	return nil
+}
+
+// linkedListener removes the socket file that was linked into place when it is
+// closed.  The listener only removes the file it was bound to.
+type linkedListener struct {
+	net.Listener
+	path string
+}
+
+func (l linkedListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// removeStale removes the socket file at path, if nothing is listening on it.
+// Files that are not sockets are left alone.
+func removeStale(c context.Context, network, path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "unix")
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("unix: %s exists and is not a socket", path)
+	}
+
+	conn, err := new(net.Dialer).DialContext(c, network, path)
+	if err == nil {
+		conn.Close()
+		return errors.Errorf("unix: %s is in use", path)
+	}
+
+	if !isErrno(err, syscall.ECONNREFUSED) {
+		return errors.Wrap(err, "unix: probe socket")
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unix")
+	}
+
+	return nil
+}
+
+// isInUse reports whether the socket file could not be created because the
+// path exists
+func isInUse(err error) bool {
+	return isErrno(err, syscall.EADDRINUSE) || isErrno(err, syscall.EEXIST)
+}
+
+func isErrno(err error, errno syscall.Errno) bool {
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+
+	if le, ok := err.(*os.LinkError); ok {
+		err = le.Err
+	}
+
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+
+	return err == errno
+}
@@ -0,0 +1,179 @@
+//go:build linux
+// +build linux
+
+package unix
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestRemoveStale(t *testing.T) {
+	a, rm := tempSock(t)
+	defer rm()
+
+	// leave a socket file behind, as a crashed process would
+	ln, err := net.ListenUnix("unix", a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ln.SetUnlinkOnClose(false)
+	ln.Close()
+
+	_, err = New().Listen(context.Background(), a)
+	assert.Error(t, err, "stale socket should be in the way")
+
+	l, err := New(OptRemoveStale(true)).Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	t.Run("InUse", func(t *testing.T) {
+		_, err := New(OptRemoveStale(true)).Listen(context.Background(), a)
+		assert.Error(t, err)
+
+		_, err = os.Lstat(a.Name)
+		assert.NoError(t, err, "live socket was removed")
+	})
+
+	t.Run("NotSocket", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "pipewerks-unix")
+		if !assert.NoError(t, err) {
+			return
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+
+		b := &net.UnixAddr{Net: "unix", Name: f.Name()}
+		_, err = New(OptRemoveStale(true)).Listen(context.Background(), b)
+		assert.Error(t, err)
+
+		_, err = os.Lstat(f.Name())
+		assert.NoError(t, err, "regular file was removed")
+	})
+}
+
+func TestSocketFile(t *testing.T) {
+	a, rm := tempSock(t)
+	defer rm()
+
+	l, err := New(
+		OptMode(0600),
+		OptOwner(os.Getuid(), os.Getgid()),
+	).Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	fi, err := os.Lstat(a.Name)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	st := fi.Sys().(*syscall.Stat_t)
+	assert.Equal(t, uint32(os.Getuid()), st.Uid)
+	assert.Equal(t, uint32(os.Getgid()), st.Gid)
+}
+
+// dirListener records the permissions of the directory holding the socket file
+// when it is bound
+type dirListener struct {
+	path string
+	mode os.FileMode
+}
+
+func (d *dirListener) Listen(c context.Context, network, address string) (net.Listener, error) {
+	l, err := new(net.ListenConfig).Listen(c, network, address)
+	if err == nil {
+		fi, _ := os.Lstat(filepath.Dir(address))
+		d.path, d.mode = address, fi.Mode().Perm()
+	}
+	return l, err
+}
+
+// TestSocketFileBind checks that the socket file is private until its mode is
+// applied, so that other users cannot connect in the meantime.
+func TestSocketFileBind(t *testing.T) {
+	a, rm := tempSock(t)
+	defer rm()
+
+	dl := new(dirListener)
+	l, err := New(OptListener(dl), OptMode(0666)).Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NotEqual(t, a.Name, dl.path, "socket was bound in place")
+	assert.Equal(t, os.FileMode(0700), dl.mode, "socket was bound in a public directory")
+
+	fi, err := os.Lstat(a.Name)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0666), fi.Mode().Perm())
+	}
+
+	_, err = os.Lstat(dl.path)
+	assert.True(t, os.IsNotExist(err), "private directory was not removed")
+
+	t.Run("InUse", func(t *testing.T) {
+		_, err := New(OptMode(0666)).Listen(context.Background(), a)
+		assert.Error(t, err)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		assert.NoError(t, l.Close())
+
+		_, err := os.Lstat(a.Name)
+		assert.True(t, os.IsNotExist(err), "socket file was not removed")
+	})
+}
+
+func TestAbstract(t *testing.T) {
+	name := fmt.Sprintf("@pipewerks-test-%d", os.Getpid())
+
+	tp, a, err := pipe.DefaultRegistry.Resolve("unix://" + name)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, name, a.String())
+
+	// options concerning the socket file do not apply
+	tp = New(OptRemoveStale(true), OptMode(0600))
+
+	l, err := tp.Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	_, err = os.Lstat(name)
+	assert.True(t, os.IsNotExist(err), "abstract socket has no file")
+
+	var g errgroup.Group
+	g.Go(func() error {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	})
+
+	conn, err := tp.Dial(context.Background(), a)
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+	assert.NoError(t, g.Wait())
+}
@@ -3,42 +3,119 @@ package unix
 import (
 	"context"
 	"net"
+	"net/url"
+	"os"
 
 	pipe "github.com/lthibault/pipewerks/pkg"
 	"github.com/lthibault/pipewerks/pkg/transport/generic"
 	"github.com/pkg/errors"
 )
 
-func checkNetwork(a net.Addr) (ok bool) {
-	switch a.Network() {
-	case "unix", "unixgram", "unixpacket":
-		ok = true
+func init() {
+	for _, scheme := range []string{"unix", "unixpacket"} {
+		pipe.Register(scheme, fromURL)
+	}
+}
+
+// fromURL accepts both absolute (unix:///path/to/sock) and relative
+// (unix://path/to/sock) paths, as well as abstract names (unix://@name).
+func fromURL(u *url.URL) (pipe.Transport, net.Addr, error) {
+	name := u.Host + u.Path
+	if u.Opaque != "" {
+		name = u.Opaque
+	} else if u.User != nil && u.User.String() == "" {
+		name = "@" + name // parsed as empty userinfo
 	}
 
-	return
+	return New(), &net.UnixAddr{Net: u.Scheme, Name: name}, nil
 }
 
-// Transport over Unix domain socket
-type Transport struct{ generic.Transport }
+// Transport over Unix domain socket.  Both stream ("unix") and sequenced packet
+// ("unixpacket") sockets are supported.  Streams over packet sockets preserve
+// message boundaries: each write is returned by a single read at the remote end,
+// provided the buffer is large enough.  Files cannot be passed over packet
+// sockets, nor can they be secured or use a different MuxAdapter.
+type Transport struct {
+	generic.Transport
+	files  bool
+	policy Policy
+
+	stale    bool
+	mode     os.FileMode
+	chown    bool
+	uid, gid int
+}
 
 // Listen Unix
 func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
-	if !checkNetwork(a) {
-		return nil, errors.Errorf("unix: invalid network %s", a.Network())
+	if err := t.prepare(a); err != nil {
+		return nil, err
+	}
+
+	t.Transport.NetListener = socketFile{
+		NetListener: t.Transport.NetListener,
+		stale:       t.stale,
+		mode:        t.mode,
+		chown:       t.chown,
+		uid:         t.uid,
+		gid:         t.gid,
+	}
+
+	if t.policy != nil {
+		t.Transport.NetListener = policyListener{t.Transport.NetListener, t.policy}
+	}
+
+	if t.files {
+		t.Transport.NetListener = fileListener{t.Transport.NetListener}
 	}
 
+	t.Transport.MuxAdapter = connMux{t.Transport.MuxAdapter}
 	return t.Transport.Listen(c, a)
 }
 
 // Dial Unix
 func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
-	if !checkNetwork(a) {
-		return nil, errors.Errorf("tcp: invalid network %s", a.Network())
+	if err := t.prepare(a); err != nil {
+		return nil, err
+	}
+
+	if t.files {
+		t.Transport.NetDialer = fileDialer{t.Transport.NetDialer}
 	}
 
+	t.Transport.MuxAdapter = connMux{t.Transport.MuxAdapter}
 	return t.Transport.Dial(c, a)
 }
 
+// prepare the transport for the address' network
+func (t *Transport) prepare(a net.Addr) error {
+	switch a.Network() {
+	case "unix":
+	case "unixpacket":
+		if t.files {
+			return errors.New("unix: files cannot be passed over unixpacket sockets")
+		}
+
+		if t.SecurityAdapter != nil {
+			return errors.New("unix: unixpacket sockets cannot be secured")
+		}
+
+		// streams are multiplexed by packetMux, which preserves message
+		// boundaries
+		if mx, ok := t.MuxAdapter.(generic.MuxConfig); !ok || mx.Config != nil {
+			return errors.New("unix: unixpacket sockets use their own multiplexer")
+		}
+
+		t.Transport.MuxAdapter = packetMux{}
+	case "unixgram":
+		return errors.New("unix: unixgram sockets are connectionless, and cannot carry streams")
+	default:
+		return errors.Errorf("unix: invalid network %s", a.Network())
+	}
+
+	return checkAbstract(a.String())
+}
+
 // New Unix Transport
 func New(opt ...Option) (t Transport) {
 	t.Transport = generic.New()
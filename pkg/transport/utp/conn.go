@@ -0,0 +1,577 @@
+package utp
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxSendBuf    = 1 << 20
+	maxRecvBuf    = 1 << 20
+	maxReorder    = 1024 // out-of-order packets held for reassembly
+	maxRetransmit = 8
+	minRTO        = 500 * time.Millisecond
+	maxRTO        = 8 * time.Second
+	linger        = 5 * time.Second
+	tick          = 10 * time.Millisecond
+)
+
+type connState uint8
+
+const (
+	stateSynSent connState = iota
+	stateConnected
+)
+
+// ErrReset is returned when the remote end resets the connection
+var ErrReset = errors.New("utp: connection reset")
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "utp: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+type outPacket struct {
+	typ     uint8
+	seq     uint16
+	payload []byte
+	sent    time.Time
+	xmit    int
+}
+
+type inPacket struct {
+	typ     uint8
+	payload []byte
+}
+
+// conn is a µTP connection.  It satisfies net.Conn.
+type conn struct {
+	cfg            Config
+	pc             net.PacketConn
+	remote         net.Addr
+	l              *listener // nil if the connection owns pc
+	recvID, sendID uint16
+
+	mu        sync.Mutex
+	state     connState
+	seq       uint16 // next sequence number to send
+	ack       uint16 // last sequence number received in order
+	lastAck   uint16 // last ack number received
+	dupAcks   int
+	unacked   []*outPacket
+	inflight  int
+	sendBuf   []byte
+	ooo       map[uint16]inPacket
+	readBuf   []byte
+	eof       bool // the remote end sent FIN, and all preceding data was received
+	closing   bool // Close was called
+	closeAt   time.Time
+	finSent   bool
+	finAcked  bool
+	peerWnd   uint32
+	replyDiff uint32
+	cc        *ledbat
+	rtt       time.Duration
+	rttVar    time.Duration
+	rto       time.Duration
+	rd, wd    time.Time
+
+	chRead, chWrite chan struct{}
+	established     chan struct{}
+	die             chan struct{}
+	dieOnce         sync.Once
+	err             error
+}
+
+func newConn(c Config, pc net.PacketConn, raddr net.Addr, l *listener) *conn {
+	return &conn{
+		cfg:         c,
+		pc:          pc,
+		remote:      raddr,
+		l:           l,
+		ooo:         make(map[uint16]inPacket),
+		peerWnd:     maxRecvBuf,
+		cc:          newLEDBAT(c.TargetDelay, c.MSS, c.MaxWindow),
+		rto:         time.Second,
+		chRead:      make(chan struct{}, 1),
+		chWrite:     make(chan struct{}, 1),
+		established: make(chan struct{}),
+		die:         make(chan struct{}),
+		err:         io.ErrClosedPipe,
+	}
+}
+
+// connect starts the handshake from the initiating side
+func (c *conn) connect(id uint16) {
+	c.recvID, c.sendID = id, id+1
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = stateSynSent
+	c.seq = 2
+
+	syn := &outPacket{typ: stSyn, seq: 1}
+	c.unacked = append(c.unacked, syn)
+	c.transmit(syn)
+
+	go c.timerLoop()
+}
+
+// accept completes the handshake from the listening side
+func (c *conn) accept(syn header, seq uint16) {
+	c.recvID, c.sendID = syn.connID+1, syn.connID
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = stateConnected
+	close(c.established)
+	c.seq = seq
+	c.ack = syn.seq
+	c.sendState()
+
+	go c.timerLoop()
+}
+
+func (c *conn) window() int {
+	if w := int(c.peerWnd); w < c.cc.size() {
+		return w
+	}
+	return c.cc.size()
+}
+
+func (c *conn) recvWindow() uint32 {
+	n := maxRecvBuf - len(c.readBuf)
+	if n < 0 {
+		return 0
+	}
+	return uint32(n)
+}
+
+func (c *conn) send(typ uint8, seq uint16, payload []byte) {
+	id := c.sendID
+	if typ == stSyn {
+		id = c.recvID
+	}
+
+	b := make([]byte, headerSize+len(payload))
+	header{
+		typ:    typ,
+		connID: id,
+		ts:     nowMicro(),
+		tsDiff: c.replyDiff,
+		wnd:    c.recvWindow(),
+		seq:    seq,
+		ack:    c.ack,
+	}.marshal(b)
+	copy(b[headerSize:], payload)
+
+	c.pc.WriteTo(b, c.remote) // lost packets are retransmitted
+}
+
+func (c *conn) sendState() { c.send(stState, c.seq, nil) }
+
+func (c *conn) transmit(p *outPacket) {
+	p.sent = time.Now()
+	p.xmit++
+	c.send(p.typ, p.seq, p.payload)
+}
+
+// flush as much buffered data as the window allows
+func (c *conn) flush() {
+	if c.state != stateConnected {
+		return
+	}
+
+	for len(c.sendBuf) > 0 {
+		n := len(c.sendBuf)
+		if n > c.cfg.MSS {
+			n = c.cfg.MSS
+		}
+
+		// always allow one packet in flight, in order to probe a closed window
+		if c.inflight > 0 && c.inflight+n > c.window() {
+			break
+		}
+
+		p := &outPacket{typ: stData, seq: c.seq, payload: append([]byte(nil), c.sendBuf[:n]...)}
+		c.seq++
+		c.sendBuf = c.sendBuf[n:]
+		c.inflight += n
+		c.unacked = append(c.unacked, p)
+		c.transmit(p)
+	}
+
+	if len(c.sendBuf) == 0 {
+		c.sendBuf = nil
+	}
+
+	if c.closing && !c.finSent && len(c.sendBuf) == 0 {
+		fin := &outPacket{typ: stFin, seq: c.seq}
+		c.seq++
+		c.finSent = true
+		c.unacked = append(c.unacked, fin)
+		c.transmit(fin)
+	}
+}
+
+// input a packet from the remote end
+func (c *conn) input(h header, payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.die:
+		return
+	default:
+	}
+
+	now := time.Now()
+	c.replyDiff = nowMicro() - h.ts
+
+	switch h.typ {
+	case stReset:
+		c.teardown(ErrReset)
+		return
+	case stSyn:
+		c.sendState() // our reply was lost
+		return
+	}
+
+	c.peerWnd = h.wnd
+
+	if c.state == stateSynSent {
+		if h.typ != stState {
+			return
+		}
+
+		c.state = stateConnected
+		c.ack = h.seq - 1
+		close(c.established)
+	}
+
+	c.processAck(h, now)
+
+	if h.typ == stData || h.typ == stFin {
+		c.processData(h, payload)
+		c.sendState()
+	}
+
+	if c.closing && c.finAcked {
+		c.teardown(io.ErrClosedPipe)
+		return
+	}
+
+	c.flush()
+	c.notify()
+}
+
+func (c *conn) processAck(h header, now time.Time) {
+	acked, newAck := 0, false
+	for len(c.unacked) > 0 && !seqLess(h.ack, c.unacked[0].seq) {
+		p := c.unacked[0]
+		c.unacked[0] = nil
+		c.unacked = c.unacked[1:]
+		c.inflight -= len(p.payload)
+		acked += len(p.payload)
+		newAck = true
+
+		if p.xmit == 1 {
+			c.updateRTT(now.Sub(p.sent))
+		}
+
+		if p.typ == stFin {
+			c.finAcked = true
+		}
+	}
+
+	switch {
+	case newAck:
+		c.dupAcks = 0
+		if acked > 0 && h.tsDiff != 0 {
+			c.cc.onAck(acked, h.tsDiff, now)
+		}
+
+	case h.typ == stState && len(c.unacked) > 0 && h.ack == c.lastAck:
+		if c.dupAcks++; c.dupAcks == 3 {
+			c.cc.onLoss()
+			c.transmit(c.unacked[0]) // fast retransmit
+		}
+	}
+
+	c.lastAck = h.ack
+}
+
+func (c *conn) processData(h header, payload []byte) {
+	if !seqLess(c.ack, h.seq) {
+		return // duplicate
+	}
+
+	if h.seq != c.ack+1 {
+		if int(h.seq-c.ack) < maxReorder {
+			c.ooo[h.seq] = inPacket{typ: h.typ, payload: append([]byte(nil), payload...)}
+		}
+		return
+	}
+
+	c.deliver(inPacket{typ: h.typ, payload: payload})
+	for {
+		p, ok := c.ooo[c.ack+1]
+		if !ok {
+			break
+		}
+
+		delete(c.ooo, c.ack+1)
+		c.deliver(p)
+	}
+}
+
+func (c *conn) deliver(p inPacket) {
+	c.ack++
+	if p.typ == stFin {
+		c.eof = true
+		return
+	}
+
+	if !c.eof && !c.closing {
+		c.readBuf = append(c.readBuf, p.payload...)
+	}
+}
+
+// updateRTT as described in BEP 29
+func (c *conn) updateRTT(sample time.Duration) {
+	if c.rtt == 0 {
+		c.rtt, c.rttVar = sample, sample/2
+	} else {
+		delta := c.rtt - sample
+		if delta < 0 {
+			delta = -delta
+		}
+
+		c.rttVar += (delta - c.rttVar) / 4
+		c.rtt += (sample - c.rtt) / 8
+	}
+
+	if c.rto = c.rtt + 4*c.rttVar; c.rto < minRTO {
+		c.rto = minRTO
+	}
+}
+
+func (c *conn) timerLoop() {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	for {
+		select {
+		case now := <-t.C:
+			c.onTick(now)
+		case <-c.die:
+			return
+		}
+	}
+}
+
+func (c *conn) onTick(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closing && now.Sub(c.closeAt) > linger {
+		c.teardown(io.ErrClosedPipe)
+		return
+	}
+
+	if len(c.unacked) > 0 {
+		if p := c.unacked[0]; now.Sub(p.sent) > c.rto {
+			if p.xmit >= maxRetransmit {
+				c.teardown(timeoutError{})
+				return
+			}
+
+			if c.rto *= 2; c.rto > maxRTO {
+				c.rto = maxRTO
+			}
+
+			c.cc.onTimeout()
+			c.transmit(p)
+		}
+	}
+
+	c.flush()
+	c.notify()
+}
+
+func (c *conn) notify() {
+	if len(c.readBuf) > 0 || c.eof {
+		notify(c.chRead)
+	}
+
+	if len(c.sendBuf) < maxSendBuf {
+		notify(c.chWrite)
+	}
+}
+
+// teardown releases the connection.  c.mu MUST be held.
+func (c *conn) teardown(err error) {
+	c.dieOnce.Do(func() {
+		c.err = err
+		close(c.die)
+
+		if c.l != nil {
+			c.l.remove(c)
+		} else {
+			c.pc.Close()
+		}
+	})
+}
+
+func (c *conn) Read(b []byte) (n int, err error) {
+	for {
+		c.mu.Lock()
+		if c.closing {
+			c.mu.Unlock()
+			return 0, io.ErrClosedPipe
+		}
+
+		if len(c.readBuf) > 0 {
+			n = copy(b, c.readBuf)
+			if c.readBuf = c.readBuf[n:]; len(c.readBuf) == 0 {
+				c.readBuf = nil
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		if c.eof {
+			c.mu.Unlock()
+			return 0, io.EOF
+		}
+
+		deadline := c.rd
+		c.mu.Unlock()
+
+		if err = c.wait(c.chRead, deadline); err != nil {
+			return
+		}
+	}
+}
+
+func (c *conn) Write(b []byte) (n int, err error) {
+	for {
+		select {
+		case <-c.die:
+			return 0, c.err
+		default:
+		}
+
+		c.mu.Lock()
+		if c.closing {
+			c.mu.Unlock()
+			return 0, io.ErrClosedPipe
+		}
+
+		if len(c.sendBuf) < maxSendBuf {
+			c.sendBuf = append(c.sendBuf, b...)
+			c.flush()
+			c.mu.Unlock()
+			return len(b), nil
+		}
+
+		deadline := c.wd
+		c.mu.Unlock()
+
+		if err = c.wait(c.chWrite, deadline); err != nil {
+			return
+		}
+	}
+}
+
+func (c *conn) wait(ch <-chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return timeoutError{}
+		}
+
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return timeoutError{}
+	case <-c.die:
+		return c.err
+	}
+}
+
+// Close sends any buffered data, followed by a FIN.  The connection lingers in
+// the background until the FIN is acknowledged.
+func (c *conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closing {
+		return nil
+	}
+
+	c.closing = true
+	c.closeAt = time.Now()
+	c.readBuf = nil
+	c.flush()
+
+	if c.state != stateConnected {
+		c.teardown(io.ErrClosedPipe)
+	}
+
+	notify(c.chRead)
+	notify(c.chWrite)
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.pc.LocalAddr() }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rd, c.wd = t, t
+	c.mu.Unlock()
+
+	notify(c.chRead)
+	notify(c.chWrite)
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rd = t
+	c.mu.Unlock()
+
+	notify(c.chRead)
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.wd = t
+	c.mu.Unlock()
+
+	notify(c.chWrite)
+	return nil
+}
+
+func notify(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,91 @@
+package utp
+
+import "time"
+
+// LEDBAT parameters, as recommended by BEP 29 and RFC 6817
+const (
+	maxCwndIncrease = 3000 // bytes per RTT
+	baseHistory     = 3    // one-minute buckets of base delay
+)
+
+// ledbat is a delay-based congestion controller.  It keeps the queuing delay it
+// induces close to a target, and backs off as soon as other traffic (such as
+// TCP) causes queues to build up.
+type ledbat struct {
+	target time.Duration
+	min    float64 // bytes
+	max    float64 // bytes
+	window float64 // bytes
+
+	base    [baseHistory]uint32
+	valid   [baseHistory]bool
+	idx     int
+	rotated time.Time
+}
+
+func newLEDBAT(target time.Duration, mss, maxWindow int) *ledbat {
+	return &ledbat{
+		target: target,
+		min:    float64(mss),
+		max:    float64(maxWindow),
+		window: float64(mss * 4),
+	}
+}
+
+// size of the congestion window, in bytes
+func (l *ledbat) size() int { return int(l.window) }
+
+// onAck updates the window.  delay is the one-way delay reported by the peer,
+// which includes an arbitrary clock offset, in microseconds.
+func (l *ledbat) onAck(acked int, delay uint32, now time.Time) {
+	l.addSample(delay, now)
+
+	ourDelay := time.Duration(delay-l.baseDelay()) * time.Microsecond
+	offTarget := float64(l.target-ourDelay) / float64(l.target)
+
+	windowFactor := float64(acked) / l.window
+	if windowFactor > 1 {
+		windowFactor = 1
+	}
+
+	l.setWindow(l.window + maxCwndIncrease*offTarget*windowFactor)
+}
+
+// onLoss halves the window
+func (l *ledbat) onLoss() { l.setWindow(l.window / 2) }
+
+// onTimeout collapses the window to a single packet
+func (l *ledbat) onTimeout() { l.setWindow(l.min) }
+
+func (l *ledbat) setWindow(w float64) {
+	if w < l.min {
+		w = l.min
+	} else if w > l.max {
+		w = l.max
+	}
+
+	l.window = w
+}
+
+func (l *ledbat) addSample(delay uint32, now time.Time) {
+	if now.Sub(l.rotated) > time.Minute {
+		l.idx = (l.idx + 1) % baseHistory
+		l.valid[l.idx] = false
+		l.rotated = now
+	}
+
+	if !l.valid[l.idx] || delay < l.base[l.idx] {
+		l.base[l.idx] = delay
+		l.valid[l.idx] = true
+	}
+}
+
+func (l *ledbat) baseDelay() (min uint32) {
+	min = ^uint32(0)
+	for i, ok := range l.valid {
+		if ok && l.base[i] < min {
+			min = l.base[i]
+		}
+	}
+	return
+}
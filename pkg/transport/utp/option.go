@@ -0,0 +1,46 @@
+package utp
+
+import (
+	"time"
+
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+)
+
+// Option for µTP transport
+type Option func(*Transport) (prev Option)
+
+// OptConfig sets the connection configuration for both dialer and listener
+func OptConfig(c Config) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptConfig(t.config())
+		OptGeneric(generic.OptDialer(c))(t)
+		OptGeneric(generic.OptListener(c))(t)
+		return
+	}
+}
+
+// OptTargetDelay sets the queuing delay targeted by LEDBAT congestion control
+func OptTargetDelay(d time.Duration) Option {
+	return func(t *Transport) (prev Option) {
+		c := t.config()
+		prev = OptTargetDelay(c.TargetDelay)
+		c.TargetDelay = d
+		OptConfig(c)(t)
+		return
+	}
+}
+
+// OptGeneric sets an option on the underlying generic transport
+func OptGeneric(opt generic.Option) Option {
+	return func(t *Transport) Option {
+		return OptGeneric(opt(&t.Transport))
+	}
+}
+
+func (t Transport) config() Config {
+	if c, ok := t.Transport.NetDialer.(Config); ok {
+		return c
+	}
+
+	return DefaultConfig
+}
@@ -0,0 +1,80 @@
+package utp
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Packet types, as defined in BEP 29
+const (
+	stData  = 0
+	stFin   = 1
+	stState = 2
+	stReset = 3
+	stSyn   = 4
+
+	version    = 1
+	headerSize = 20
+)
+
+var refTime = time.Now()
+
+// nowMicro returns a monotonic timestamp, in microseconds
+func nowMicro() uint32 { return uint32(time.Since(refTime) / time.Microsecond) }
+
+type header struct {
+	typ        uint8
+	connID     uint16
+	ts, tsDiff uint32
+	wnd        uint32
+	seq, ack   uint16
+}
+
+func (h header) marshal(b []byte) {
+	b[0] = h.typ<<4 | version
+	b[1] = 0 // no extensions
+	binary.BigEndian.PutUint16(b[2:], h.connID)
+	binary.BigEndian.PutUint32(b[4:], h.ts)
+	binary.BigEndian.PutUint32(b[8:], h.tsDiff)
+	binary.BigEndian.PutUint32(b[12:], h.wnd)
+	binary.BigEndian.PutUint16(b[16:], h.seq)
+	binary.BigEndian.PutUint16(b[18:], h.ack)
+}
+
+// unmarshal the header, returning the payload.  Extensions are skipped.
+func (h *header) unmarshal(b []byte) ([]byte, error) {
+	if len(b) < headerSize {
+		return nil, errors.New("short packet")
+	}
+
+	if b[0]&0xf != version {
+		return nil, errors.Errorf("unsupported version %d", b[0]&0xf)
+	}
+
+	if h.typ = b[0] >> 4; h.typ > stSyn {
+		return nil, errors.Errorf("invalid packet type %d", h.typ)
+	}
+
+	h.connID = binary.BigEndian.Uint16(b[2:])
+	h.ts = binary.BigEndian.Uint32(b[4:])
+	h.tsDiff = binary.BigEndian.Uint32(b[8:])
+	h.wnd = binary.BigEndian.Uint32(b[12:])
+	h.seq = binary.BigEndian.Uint16(b[16:])
+	h.ack = binary.BigEndian.Uint16(b[18:])
+
+	ext, p := b[1], b[headerSize:]
+	for ext != 0 {
+		if len(p) < 2 || len(p) < 2+int(p[1]) {
+			return nil, errors.New("malformed extension")
+		}
+
+		ext, p = p[0], p[2+int(p[1]):]
+	}
+
+	return p, nil
+}
+
+// seqLess compares sequence numbers, accounting for wraparound
+func seqLess(a, b uint16) bool { return int16(a-b) < 0 }
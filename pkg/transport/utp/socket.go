@@ -0,0 +1,259 @@
+package utp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	mtuLimit      = 1500
+	acceptBacklog = 128
+)
+
+// Config for µTP connections.  It satisfies both generic.NetDialer and
+// generic.NetListener.
+type Config struct {
+	// TargetDelay is the queuing delay LEDBAT aims to induce.  Lower values
+	// yield to competing traffic more aggressively.
+	TargetDelay time.Duration
+
+	// MSS is the maximum payload size of a packet, excluding the µTP header.
+	MSS int
+
+	// MaxWindow caps the congestion window, in bytes.
+	MaxWindow int
+}
+
+// DefaultConfig uses the parameters recommended by BEP 29
+var DefaultConfig = Config{
+	TargetDelay: 100 * time.Millisecond,
+	MSS:         1200,
+	MaxWindow:   1 << 20,
+}
+
+// DialContext opens a µTP connection over a new UDP socket
+func (c Config) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve")
+	}
+
+	pc, err := new(net.ListenConfig).ListenPacket(ctx, network, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "listen packet")
+	}
+
+	var b [2]byte
+	if _, err = rand.Read(b[:]); err != nil {
+		pc.Close()
+		return nil, errors.Wrap(err, "conn id")
+	}
+
+	conn := newConn(c, pc, raddr, nil)
+	conn.connect(binary.BigEndian.Uint16(b[:]))
+	go readLoop(conn)
+
+	select {
+	case <-conn.established:
+		return conn, nil
+	case <-conn.die:
+		return nil, errors.Wrap(conn.err, "handshake")
+	case <-ctx.Done():
+		conn.mu.Lock()
+		conn.teardown(ctx.Err())
+		conn.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// readLoop is used by dialed connections, which own their socket
+func readLoop(c *conn) {
+	buf := make([]byte, mtuLimit)
+	for {
+		n, addr, err := c.pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		if addr.String() != c.remote.String() {
+			continue
+		}
+
+		var h header
+		payload, err := h.unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		// resets may carry either ID
+		if h.connID == c.recvID || (h.typ == stReset && h.connID == c.sendID) {
+			c.input(h, payload)
+		}
+	}
+}
+
+// Listen for µTP connections on a UDP socket
+func (c Config) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	pc, err := new(net.ListenConfig).ListenPacket(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &listener{
+		cfg:    c,
+		pc:     pc,
+		conns:  make(map[connKey]*conn),
+		accept: make(chan *conn, acceptBacklog),
+		die:    make(chan struct{}),
+	}
+	go l.readLoop()
+
+	return l, nil
+}
+
+type connKey struct {
+	addr string
+	id   uint16
+}
+
+type listener struct {
+	cfg Config
+	pc  net.PacketConn
+
+	mu    sync.Mutex
+	conns map[connKey]*conn
+
+	accept  chan *conn
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.die:
+		return nil, errors.New("utp: listener closed")
+	}
+}
+
+func (l *listener) Addr() net.Addr { return l.pc.LocalAddr() }
+
+// Close the listener and all of its connections, which share its socket.
+func (l *listener) Close() (err error) {
+	l.dieOnce.Do(func() {
+		close(l.die)
+		err = l.pc.Close()
+
+		l.mu.Lock()
+		cs := make([]*conn, 0, len(l.conns))
+		for _, c := range l.conns {
+			cs = append(cs, c)
+		}
+		l.mu.Unlock()
+
+		for _, c := range cs {
+			c.mu.Lock()
+			c.teardown(errors.New("utp: listener closed"))
+			c.mu.Unlock()
+		}
+	})
+	return
+}
+
+func (l *listener) readLoop() {
+	defer l.Close()
+
+	buf := make([]byte, mtuLimit)
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var h header
+		payload, err := h.unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		c, known := l.lookup(addr, h)
+		if c != nil {
+			c.input(h, payload)
+		} else if !known && h.typ != stReset {
+			l.reset(addr, h)
+		}
+	}
+}
+
+// lookup the connection for a packet.  New connections are created in response
+// to SYN packets, which are then fully handled.  known is false if the packet
+// belongs to no connection.
+func (l *listener) lookup(addr net.Addr, h header) (c *conn, known bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := connKey{addr: addr.String(), id: h.connID}
+	switch h.typ {
+	case stSyn:
+		key.id++
+		if c, ok := l.conns[key]; ok {
+			return c, true
+		}
+
+		// drop the SYN if the backlog is full; it will be retransmitted
+		var b [2]byte
+		if _, err := rand.Read(b[:]); err != nil || len(l.accept) == cap(l.accept) {
+			return nil, true
+		}
+
+		c = newConn(l.cfg, l.pc, addr, l)
+		c.accept(h, binary.BigEndian.Uint16(b[:]))
+		l.conns[key] = c
+		l.accept <- c
+		return nil, true
+
+	case stReset:
+		// resets may carry either ID
+		for k, c := range l.conns {
+			if k.addr == key.addr && (c.recvID == h.connID || c.sendID == h.connID) {
+				return c, true
+			}
+		}
+		return nil, false
+
+	default:
+		c, known = l.conns[key]
+		return
+	}
+}
+
+// reset a connection that is unknown to the listener
+func (l *listener) reset(addr net.Addr, h header) {
+	b := make([]byte, headerSize)
+	header{
+		typ:    stReset,
+		connID: h.connID,
+		ts:     nowMicro(),
+		seq:    h.ack,
+		ack:    h.seq,
+	}.marshal(b)
+
+	l.pc.WriteTo(b, addr)
+}
+
+func (l *listener) remove(c *conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := connKey{addr: c.remote.String(), id: c.recvID}
+	if l.conns[key] == c {
+		delete(l.conns, key)
+	}
+}
@@ -0,0 +1,71 @@
+// Package utp implements the Micro Transport Protocol (µTP) over UDP.
+//
+// The implementation is independent of libutp.  It follows the packet format of
+// BEP 29, but omits extensions such as selective ACKs, and has not been tested
+// against libutp.  It is therefore NOT interoperable with libutp or BitTorrent
+// clients; both ends of a connection should use this package.
+package utp
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+func init() { pipe.Register("utp", fromURL) }
+
+func fromURL(u *url.URL) (pipe.Transport, net.Addr, error) {
+	a, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "utp")
+	}
+
+	return New(), a, nil
+}
+
+func checkNetwork(a net.Addr) (ok bool) {
+	switch a.Network() {
+	case "udp", "udp4", "udp6":
+		ok = true
+	}
+
+	return
+}
+
+// Transport over µTP.  µTP provides reliable, ordered delivery over UDP, with
+// LEDBAT congestion control that yields bandwidth to competing TCP flows.
+type Transport struct{ generic.Transport }
+
+// Listen µTP
+func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("utp: invalid network %s", a.Network())
+	}
+
+	return t.Transport.Listen(c, a)
+}
+
+// Dial µTP
+func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("utp: invalid network %s", a.Network())
+	}
+
+	return t.Transport.Dial(c, a)
+}
+
+// New µTP Transport
+func New(opt ...Option) (t Transport) {
+	t.Transport = generic.New()
+	OptConfig(DefaultConfig)(&t)
+
+	for _, fn := range opt {
+		fn(&t)
+	}
+
+	return t
+}
@@ -0,0 +1,194 @@
+package utp
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+var loopback = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+func TestIntegration(t *testing.T) {
+	transporttest.Run(t, New(), loopback)
+}
+
+func TestBulkTransfer(t *testing.T) {
+	t.Run("Yamux", func(t *testing.T) {
+		testBulkTransfer(t, New())
+	})
+
+	t.Run("Smux", func(t *testing.T) {
+		testBulkTransfer(t, New(OptGeneric(generic.OptMuxAdapter(generic.SmuxConfig{}))))
+	})
+}
+
+func testBulkTransfer(t *testing.T, tp pipe.Transport) {
+	c, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	l, err := tp.Listen(c, loopback)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	payload := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	var g errgroup.Group
+	g.Go(func() error {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		s, err := conn.AcceptStream()
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		got, err := ioutil.ReadAll(s)
+		if err != nil {
+			return err
+		}
+
+		assert.Equal(t, payload, got)
+		return nil
+	})
+
+	conn, err := tp.Dial(c, l.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	s, err := conn.OpenStream()
+	assert.NoError(t, err)
+
+	_, err = s.Write(payload)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CloseWrite())
+
+	assert.NoError(t, g.Wait())
+}
+
+func TestDialTimeout(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pc.Close() // black hole
+
+	c, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	_, err = New().Dial(c, pc.LocalAddr())
+	assert.Error(t, err)
+}
+
+func TestWriteAfterReset(t *testing.T) {
+	cfg := DefaultConfig
+	l, err := cfg.Listen(context.Background(), "udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	addr := l.Addr().String()
+
+	var g errgroup.Group
+	g.Go(func() error {
+		_, err := l.Accept()
+		return err
+	})
+
+	dc, err := cfg.DialContext(context.Background(), "udp", addr)
+	if !assert.NoError(t, err) {
+		l.Close()
+		return
+	}
+	defer dc.Close()
+	assert.NoError(t, g.Wait())
+
+	// A listener restarted on the same port does not know the connection, and
+	// resets it.
+	assert.NoError(t, l.Close())
+	if l, err = cfg.Listen(context.Background(), "udp", addr); !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	_, err = dc.Write([]byte("reset"))
+	assert.NoError(t, err)
+
+	select {
+	case <-dc.(*conn).die:
+	case <-time.After(time.Second * 5):
+		t.Fatal("connection was not reset")
+	}
+
+	_, err = dc.Write([]byte("after reset"))
+	assert.Equal(t, ErrReset, err)
+}
+
+func TestCheckNetwork(t *testing.T) {
+	_, err := New().Dial(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+
+	_, err = New().Listen(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+}
+
+func TestURL(t *testing.T) {
+	tp, a, err := pipe.DefaultRegistry.Resolve("utp://127.0.0.1:9001")
+	assert.NoError(t, err)
+	assert.IsType(t, Transport{}, tp)
+	assert.Equal(t, "udp", a.Network())
+}
+
+func TestLEDBAT(t *testing.T) {
+	const mss = 1000
+	now := time.Now()
+
+	t.Run("Grow", func(t *testing.T) {
+		cc := newLEDBAT(100*time.Millisecond, mss, 1<<20)
+		w := cc.size()
+
+		cc.onAck(mss, 5000, now) // establishes base delay
+		cc.onAck(mss, 5000, now)
+		assert.True(t, cc.size() > w, "window should grow while below target")
+	})
+
+	t.Run("Yield", func(t *testing.T) {
+		cc := newLEDBAT(100*time.Millisecond, mss, 1<<20)
+		cc.onAck(mss, 5000, now)
+		w := cc.size()
+
+		// competing traffic adds 200ms of queuing delay
+		for i := 0; i < 10; i++ {
+			cc.onAck(mss, 205000, now)
+		}
+		assert.True(t, cc.size() < w, "window should shrink above target")
+		assert.True(t, cc.size() >= mss)
+	})
+
+	t.Run("Loss", func(t *testing.T) {
+		cc := newLEDBAT(100*time.Millisecond, mss, 1<<20)
+		w := cc.size()
+
+		cc.onLoss()
+		assert.Equal(t, w/2, cc.size())
+
+		cc.onTimeout()
+		assert.Equal(t, mss, cc.size())
+	})
+}
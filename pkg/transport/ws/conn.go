@@ -0,0 +1,96 @@
+package ws
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const closeTimeout = time.Second
+
+// conn adapts a WebSocket to net.Conn.  Each write is sent as a binary message,
+// and incoming messages are concatenated into a byte stream.
+type conn struct {
+	ws *websocket.Conn
+
+	rmu sync.Mutex
+	r   io.Reader // current message
+
+	wmu sync.Mutex
+}
+
+func newConn(ws *websocket.Conn) *conn { return &conn{ws: ws} }
+
+func (c *conn) Read(b []byte) (n int, err error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for {
+		if c.r == nil {
+			var typ int
+			if typ, c.r, err = c.ws.NextReader(); err != nil {
+				c.r = nil
+				return 0, mapErr(err)
+			}
+
+			if typ != websocket.BinaryMessage {
+				c.r = nil
+				continue
+			}
+		}
+
+		if n, err = c.r.Read(b); err == io.EOF {
+			c.r = nil
+			if err = nil; n == 0 {
+				continue
+			}
+		}
+
+		return n, mapErr(err)
+	}
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, mapErr(err)
+	}
+
+	return len(b), nil
+}
+
+// Close sends a close frame on a best-effort basis before closing the
+// underlying connection.
+func (c *conn) Close() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+	return c.ws.Close()
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.ws.LocalAddr() }
+func (c *conn) RemoteAddr() net.Addr { return c.ws.RemoteAddr() }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *conn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
+
+// mapErr reports orderly closure as io.EOF
+func mapErr(err error) error {
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return io.EOF
+	}
+
+	return err
+}
@@ -0,0 +1,101 @@
+package ws
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/pkg/errors"
+)
+
+// handler upgrades HTTP requests to WebSocket connections, and hands them to
+// Accept.  It satisfies both http.Handler and net.Listener.
+type handler struct {
+	up    *websocket.Upgrader
+	addr  net.Addr
+	conns chan net.Conn
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+func newHandler(up *websocket.Upgrader, a net.Addr) *handler {
+	return &handler{
+		up:    up,
+		addr:  a,
+		conns: make(chan net.Conn),
+		die:   make(chan struct{}),
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-h.die:
+		http.Error(w, "listener closed", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	ws, err := h.up.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade replied with an HTTP error
+	}
+
+	select {
+	case h.conns <- newConn(ws):
+	case <-h.die:
+		ws.Close()
+	}
+}
+
+func (h *handler) Accept() (net.Conn, error) {
+	select {
+	case c := <-h.conns:
+		return c, nil
+	case <-h.die:
+		return nil, errors.New("ws: listener closed")
+	}
+}
+
+func (h *handler) Addr() net.Addr { return h.addr }
+
+func (h *handler) Close() error {
+	h.dieOnce.Do(func() { close(h.die) })
+	return nil
+}
+
+// Listen satisfies generic.NetListener by returning the handler itself
+func (h *handler) Listen(context.Context, string, string) (net.Listener, error) {
+	return h, nil
+}
+
+// Handler is a pipe.Listener that accepts connections from an http.Handler.  It
+// can be mounted on an existing http.Server, allowing pipewerks connections to
+// share a port with other HTTP services.
+type Handler struct {
+	pipe.Listener
+	h *handler
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection, which is returned
+// by Accept.  ServeHTTP blocks until the connection is accepted or the listener
+// is closed.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { h.h.ServeHTTP(w, r) }
+
+// server is a standalone HTTP server for a single handler
+type server struct {
+	*handler
+	srv *http.Server
+}
+
+func (s server) Listen(context.Context, string, string) (net.Listener, error) {
+	return s, nil
+}
+
+func (s server) Close() error {
+	s.handler.Close()
+	return s.srv.Close()
+}
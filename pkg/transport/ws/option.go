@@ -0,0 +1,47 @@
+package ws
+
+import (
+	"crypto/tls"
+
+	"github.com/gorilla/websocket"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+)
+
+// Option for WebSocket transport
+type Option func(*Transport) (prev Option)
+
+// OptDialer sets the WebSocket dialer
+func OptDialer(d *websocket.Dialer) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptDialer(t.d)
+		t.d = d
+		return
+	}
+}
+
+// OptUpgrader sets the upgrader used by listeners.  Its CheckOrigin function
+// should be set when accepting connections from browsers.
+func OptUpgrader(up *websocket.Upgrader) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptUpgrader(t.up)
+		t.up = up
+		return
+	}
+}
+
+// OptTLS sets the TLS configuration for wss.  Listeners require a certificate.
+// Dialers use it unless the dialer has its own TLSClientConfig.
+func OptTLS(c *tls.Config) Option {
+	return func(t *Transport) (prev Option) {
+		prev = OptTLS(t.tls)
+		t.tls = c
+		return
+	}
+}
+
+// OptGeneric sets an option on the underlying generic transport
+func OptGeneric(opt generic.Option) Option {
+	return func(t *Transport) Option {
+		return OptGeneric(opt(&t.Transport))
+	}
+}
@@ -0,0 +1,179 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/transport/generic"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	for _, scheme := range []string{"ws", "wss"} {
+		pipe.Register(scheme, fromURL)
+	}
+}
+
+func fromURL(u *url.URL) (pipe.Transport, net.Addr, error) {
+	return New(), Addr{URL: u}, nil
+}
+
+// Addr is a WebSocket URL.  Its network is the URL scheme, i.e. "ws" or "wss".
+type Addr struct{ *url.URL }
+
+// ParseAddr parses a ws:// or wss:// URL
+func ParseAddr(rawurl string) (Addr, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Addr{}, errors.Wrap(err, "ws")
+	}
+
+	return Addr{URL: u}, nil
+}
+
+// Network is "ws" or "wss"
+func (a Addr) Network() string { return a.Scheme }
+
+func (a Addr) String() string { return a.URL.String() }
+
+func checkNetwork(a net.Addr) (ok bool) {
+	switch a.Network() {
+	case "ws", "wss":
+		ok = true
+	}
+
+	return
+}
+
+// Transport over WebSocket.  Binary messages carry a byte stream, which is
+// multiplexed by the generic transport.
+type Transport struct {
+	generic.Transport
+
+	d   *websocket.Dialer
+	up  *websocket.Upgrader
+	tls *tls.Config
+}
+
+// Listen starts an HTTP server on the address' host, which accepts WebSocket
+// connections on the address' path.  wss addresses require a TLS configuration
+// with a certificate.
+func (t Transport) Listen(c context.Context, a net.Addr) (pipe.Listener, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("ws: invalid network %s", a.Network())
+	}
+
+	u, err := url.Parse(a.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "ws")
+	}
+
+	ln, err := new(net.ListenConfig).Listen(c, "tcp", u.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen")
+	}
+
+	if u.Scheme == "wss" {
+		if t.tls == nil {
+			ln.Close()
+			return nil, errors.New("ws: wss requires a TLS configuration")
+		}
+
+		ln = tls.NewListener(ln, t.tls)
+	}
+
+	// report the bound address, in case the port was chosen by the OS
+	bound := *u
+	bound.Host = ln.Addr().String()
+
+	h := newHandler(t.up, Addr{URL: &bound})
+	mux := http.NewServeMux()
+	mux.Handle(path(u), h)
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+
+	t.Transport.NetListener = server{handler: h, srv: srv}
+	return t.Transport.Listen(c, a)
+}
+
+// Handler returns a listener that accepts WebSocket connections through
+// ServeHTTP, for use with an existing http.Server.  The address is reported by
+// the listener, but is not otherwise used.
+func (t Transport) Handler(c context.Context, a net.Addr) (*Handler, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("ws: invalid network %s", a.Network())
+	}
+
+	h := newHandler(t.up, a)
+	t.Transport.NetListener = h
+
+	l, err := t.Transport.Listen(c, a)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{Listener: l, h: h}, nil
+}
+
+// Dial a WebSocket URL
+func (t Transport) Dial(c context.Context, a net.Addr) (pipe.Conn, error) {
+	if !checkNetwork(a) {
+		return nil, errors.Errorf("ws: invalid network %s", a.Network())
+	}
+
+	t.Transport.NetDialer = dialer{t.d, t.tls}
+	return t.Transport.Dial(c, a)
+}
+
+func path(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+
+	return u.Path
+}
+
+type dialer struct {
+	*websocket.Dialer
+	tls *tls.Config
+}
+
+func (d dialer) DialContext(c context.Context, network, address string) (net.Conn, error) {
+	wd := *d.Dialer
+	if wd.TLSClientConfig == nil {
+		wd.TLSClientConfig = d.tls
+	}
+
+	ws, resp, err := wd.DialContext(c, address, nil)
+	if err != nil {
+		if resp != nil {
+			return nil, errors.Wrapf(err, "handshake (%s)", resp.Status)
+		}
+
+		return nil, err
+	}
+
+	return newConn(ws), nil
+}
+
+// New WebSocket Transport
+func New(opt ...Option) (t Transport) {
+	t.Transport = generic.New()
+	t.d = &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+	}
+	t.up = new(websocket.Upgrader)
+
+	for _, fn := range opt {
+		fn(&t)
+	}
+
+	return t
+}
@@ -0,0 +1,98 @@
+package ws
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pipe "github.com/lthibault/pipewerks/pkg"
+	"github.com/lthibault/pipewerks/pkg/internal/transporttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegration(t *testing.T) {
+	tp := New()
+
+	a, err := ParseAddr("ws://127.0.0.1:0/pipe")
+	assert.NoError(t, err)
+
+	l, err := tp.Listen(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { assert.NoError(t, l.Close()) }()
+
+	assert.Equal(t, "ws", l.Addr().Network())
+	assert.NotContains(t, l.Addr().String(), ":0/")
+
+	transporttest.RunListener(t, tp, l, l.Addr())
+}
+
+func TestHandler(t *testing.T) {
+	tp := New()
+
+	a, err := ParseAddr("ws://localhost/pipe")
+	assert.NoError(t, err)
+
+	h, err := tp.Handler(context.Background(), a)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { assert.NoError(t, h.Close()) }()
+
+	// share the port with a REST endpoint
+	mux := http.NewServeMux()
+	mux.Handle("/pipe", h)
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	t.Run("WS", func(t *testing.T) {
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/api")
+		if assert.NoError(t, err) {
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, "ok", string(b))
+		}
+
+		a, err := ParseAddr(strings.Replace(srv.URL, "http", "ws", 1) + "/pipe")
+		assert.NoError(t, err)
+
+		transporttest.RunListener(t, tp, h, a)
+	})
+
+	t.Run("WSS", func(t *testing.T) {
+		srv := httptest.NewTLSServer(mux)
+		defer srv.Close()
+
+		a, err := ParseAddr(strings.Replace(srv.URL, "https", "wss", 1) + "/pipe")
+		assert.NoError(t, err)
+
+		tc := srv.Client().Transport.(*http.Transport).TLSClientConfig
+		transporttest.RunListener(t, New(OptTLS(tc)), h, a)
+	})
+}
+
+func TestCheckNetwork(t *testing.T) {
+	_, err := New().Dial(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+
+	_, err = New().Listen(context.Background(), &net.TCPAddr{})
+	assert.Error(t, err)
+}
+
+func TestURL(t *testing.T) {
+	tp, a, err := pipe.DefaultRegistry.Resolve("wss://example.com/pipe")
+	assert.NoError(t, err)
+	assert.IsType(t, Transport{}, tp)
+	assert.Equal(t, "wss", a.Network())
+	assert.Equal(t, "wss://example.com/pipe", a.String())
+}